@@ -10,7 +10,7 @@ require github.com/google/go-cmp v0.6.0 // indirect
 
 require (
 	github.com/BelWue/bgp_routeinfo v0.0.0-20221004100427-d8095fc566dd // indirect
-	github.com/BelWue/flowpipeline v1.3.1-0.20250127122013-c865e669d527 // indirect
+	github.com/BelWue/flowpipeline v1.3.1-0.20250127122013-c865e669d527
 	github.com/ClickHouse/ch-go v0.63.1 // indirect
 	github.com/ClickHouse/clickhouse-go/v2 v2.30.1 // indirect
 	github.com/IBM/sarama v1.45.0 // indirect
@@ -21,8 +21,8 @@ require (
 	github.com/andybalholm/brotli v1.1.1 // indirect
 	github.com/apapsch/go-jsonmerge/v2 v2.0.0 // indirect
 	github.com/asecurityteam/rolling v2.0.4+incompatible // indirect
-	github.com/banviktor/asnlookup v0.1.1 // indirect
-	github.com/banviktor/go-mrt v0.0.0-20230515165434-0ce2ad0d8984 // indirect
+	github.com/banviktor/asnlookup v0.1.1
+	github.com/banviktor/go-mrt v0.0.0-20230515165434-0ce2ad0d8984
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/bwNetFlow/ip_prefix_trie v0.0.0-20210830112018-b360b7b65c04 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
@@ -65,7 +65,7 @@ require (
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/netsampler/goflow2/v2 v2.2.1 // indirect
 	github.com/oapi-codegen/runtime v1.1.1 // indirect
-	github.com/oschwald/maxminddb-golang v1.13.1 // indirect
+	github.com/oschwald/maxminddb-golang v1.13.1
 	github.com/osrg/gobgp/v3 v3.33.0 // indirect
 	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
 	github.com/paulmach/orb v0.11.1 // indirect
@@ -111,5 +111,5 @@ require (
 	google.golang.org/protobuf v1.36.4 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
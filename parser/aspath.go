@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AsPathRegex is a regular expression over AS paths, in which each term
+// refers to a whole ASN. Terms are ASNs or '.' for any ASN, and can be
+// combined using groups, alternation, repetition and anchors as usual, i.e.
+// `^553 (174|3356) .* 6830$`. Without anchors, any part of the path may
+// match. Underscores are accepted as term separators, like whitespace, so
+// that simple Cisco style expressions like `_553_` work as well.
+type AsPathRegex struct {
+	Expr   string
+	Regexp *regexp.Regexp
+}
+
+func (o AsPathRegex) children() []Node { return nil }
+
+func (o *AsPathRegex) Capture(values []string) error {
+	re, err := compileAsPathRegex(values[0])
+	if err != nil {
+		return fmt.Errorf("bad aspath regex %q: %w", values[0], err)
+	}
+	*o = AsPathRegex{Expr: values[0], Regexp: re}
+	return nil
+}
+
+// AsPathString formats an AS path the way AsPathRegex expects it, which is
+// each ASN prefixed by a space.
+func AsPathString(path []uint32) string {
+	var b strings.Builder
+	for _, asn := range path {
+		fmt.Fprintf(&b, " %d", asn)
+	}
+	return b.String()
+}
+
+// compileAsPathRegex translates the terms of an AS path regex to match
+// within the output of AsPathString.
+func compileAsPathRegex(expr string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t' || c == '_':
+			continue
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+				j++
+			}
+			fmt.Fprintf(&b, `(?: %s\b)`, expr[i:j])
+			i = j - 1
+		case c == '.':
+			b.WriteString(`(?: \d+)`)
+		case c == '{':
+			// repetition counts are passed verbatim
+			j := strings.IndexByte(expr[i:], '}')
+			if j < 0 {
+				return nil, fmt.Errorf("missing '}'")
+			}
+			b.WriteString(expr[i : i+j+1])
+			i += j
+		case strings.IndexByte("^$()|*+?", c) >= 0:
+			b.WriteByte(c)
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return regexp.Compile(b.String())
+}
@@ -1,6 +1,13 @@
 package parser
 
-import "net"
+import (
+	"fmt"
+	"math/bits"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Node is an interface implemented by all AST nodes
 type Node interface {
@@ -13,6 +20,7 @@ type BranchNode struct {
 	EvalResult    bool
 	EvalResultSrc bool
 	EvalResultDst bool
+	EvalUnknown   bool // EvalResult is to be ignored, see visitors.Filter
 }
 
 // The overall structure of this grammar. Expressions are made up of statements
@@ -34,12 +42,114 @@ type Statement struct {
 	Negated          *Boolean               `@Negation? (`
 	DirectionalMatch *DirectionalMatchGroup `  @@`
 	RegularMatch     *RegularMatchGroup     `| @@`
-	SubExpression    *Expression            `| "(" @@ ")" )`
+	SubExpression    *Expression            `| "(" @@ ")"`
+	Comparison       *Comparison            `| @@ )` // last, as `bytes >1G` is a match
 }
 
 func (o Statement) children() []Node {
 	return []Node{o.Negated, o.DirectionalMatch, o.RegularMatch,
-		o.SubExpression}
+		o.SubExpression, o.Comparison}
+}
+
+// Comparisons compare two fields of a flow, i.e. `src asn == dst asn`, or
+// arithmetic expressions thereof, i.e. `bytes / packets > 1400`. The fields'
+// types are checked after parsing.
+type Comparison struct {
+	BranchNode
+	Left     *Sum    `@@`
+	Operator *String `@(Comparator|Unary)`
+	Right    *Sum    `@@`
+}
+
+func (o Comparison) children() []Node {
+	return []Node{o.Left, o.Operator, o.Right}
+}
+
+type FieldRef struct {
+	BranchNode
+	Direction *String `@("src"|"dst")?`
+	Field     *String `@(Match|Identifier)`
+}
+
+func (o FieldRef) children() []Node {
+	return []Node{o.Direction, o.Field}
+}
+
+// Name returns the name of the referenced field as used by ComparableFields.
+func (o FieldRef) Name() string {
+	if o.Direction != nil {
+		return string(*o.Direction) + " " + string(*o.Field)
+	}
+	return strings.ToLower(string(*o.Field))
+}
+
+// Arithmetic on numeric fields, with the usual precedence of `*` and `/`
+// over `+` and `-`. All operators are left associative.
+type Sum struct {
+	BranchNode
+	Left  *Product        `@@`
+	Right []*SumOperation `@@*`
+}
+
+func (o Sum) children() []Node {
+	children := []Node{o.Left}
+	for _, op := range o.Right {
+		children = append(children, op)
+	}
+	return children
+}
+
+type SumOperation struct {
+	BranchNode
+	Operator *String  `@("+"|"-")`
+	Right    *Product `@@`
+}
+
+func (o SumOperation) children() []Node {
+	return []Node{o.Operator, o.Right}
+}
+
+type Product struct {
+	BranchNode
+	Left  *Operand            `@@`
+	Right []*ProductOperation `@@*`
+}
+
+func (o Product) children() []Node {
+	children := []Node{o.Left}
+	for _, op := range o.Right {
+		children = append(children, op)
+	}
+	return children
+}
+
+type ProductOperation struct {
+	BranchNode
+	Operator *String  `@("*"|"/")`
+	Right    *Operand `@@`
+}
+
+func (o ProductOperation) children() []Node {
+	return []Node{o.Operator, o.Right}
+}
+
+type Operand struct {
+	BranchNode
+	Number *Number   `@Number`
+	Field  *FieldRef `| @@`
+	Sum    *Sum      `| "(" @@ ")"`
+}
+
+func (o Operand) children() []Node {
+	return []Node{o.Number, o.Field, o.Sum}
+}
+
+// Field returns the field referenced by a Sum if it consists of nothing else.
+func (o Sum) Field() *FieldRef {
+	if len(o.Right) > 0 || len(o.Left.Right) > 0 {
+		return nil
+	}
+	return o.Left.Left.Field
 }
 
 // Basic data type nodes which are mostly just aliases
@@ -59,18 +169,52 @@ type Number uint64
 
 func (o Number) children() []Node { return nil }
 
+// Multipliers for number suffixes, i.e. `1G` or `1Gi`.
+var numberSuffixes = map[string]uint64{
+	"k": 1e3, "M": 1e6, "G": 1e9, "T": 1e12,
+	"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40,
+}
+
+// Numbers are given in seconds where the grammar accepts durations, i.e.
+// `age >5m`.
+func (o *Number) Capture(values []string) error {
+	value, multiplier := values[0], uint64(1)
+	if i := strings.IndexAny(value, "kMGT"); i >= 0 {
+		value, multiplier = value[:i], numberSuffixes[value[i:]]
+	}
+	n, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		var duration Duration
+		if duration.Capture(values) != nil {
+			return err
+		}
+		*o = Number(time.Duration(duration) / time.Second)
+		return nil
+	}
+	hi, lo := bits.Mul64(n, multiplier)
+	if hi != 0 {
+		return fmt.Errorf("number %q out of range", values[0])
+	}
+	*o = Number(lo)
+	return nil
+}
+
 // FIXME: pseudo "negative" Number
 // used by the printer visitor only, for emitting a "-" between children
 type RangeEnd Number
 
 func (o RangeEnd) children() []Node { return nil }
 
+func (o *RangeEnd) Capture(values []string) error {
+	return (*Number)(o).Capture(values)
+}
+
 type NumericRange struct {
 	BranchNode
-	Lower  *Number   `(@Number`
+	Lower  *Number   `((@Number`
 	Upper  *RangeEnd `"-" @Number) |`
 	Unary  *String   `( @Unary?`
-	Number *Number   `  @Number )`
+	Number *Number   `  @Number ))`
 }
 
 func (o NumericRange) children() []Node {
@@ -87,52 +231,90 @@ func (o NumericRange) children() []Node {
 // * several dedicated Match structs for different data types and sub commands
 type RegularMatchGroup struct {
 	BranchNode
-	Router        *RouterMatch            `"router" @@`
-	NextHop       *NextHopMatch           `| "nexthop" @@`
-	NextHopAsn    *NextHopAsnMatch        `| "nexthopasn" @@`
-	Bytes         *ByteRangeMatch         `| "bytes" @@`
-	Packets       *PacketRangeMatch       `| "packets" @@`
-	RemoteCountry *RemoteCountryMatch     `| "country" @@`
-	FlowDirection *FlowDirectionMatch     `| "direction"? @@`
-	Normalized    *NormalizedMatch        `| @@`
-	Duration      *DurationRangeMatch     `| "duration" @@`
-	Etype         *EtypeMatch             `| "etype" @@`
-	Proto         *ProtoMatch             `| "proto" @@`
-	Status        *StatusMatch            `| "status" @@`
-	TcpFlags      *TcpFlagsMatch          `| "tcpflags" @@`
-	IpTos         *IpTosRangeMatch        `| "iptos" @@`
-	Dscp          *DscpMatch              `| "dscp" @@`
-	Ecn           *EcnMatch               `| "ecn" @@`
-	SamplingRate  *SamplingRateRangeMatch `| "samplingrate" @@`
-	Icmp          *IcmpMatch              `| "icmp" @@`
-	Bps           *BpsRangeMatch          `| "bps" @@`
-	Pps           *PpsRangeMatch          `| "pps" @@`
-	PassesThrough *PassesThroughListMatch `| "passes-through" @@`
-	Med           *MedRangeMatch          `| "med" @@`
-	LocalPref     *LocalPrefRangeMatch    `| "localpref" @@`
-	Rpki          *RpkiMatch              `| "rpki" @@`
+	Router         *RouterMatch              `"router" @@`
+	NextHop        *NextHopMatch             `| "nexthop" @@`
+	NextHopAsn     *NextHopAsnMatch          `| "nexthopasn" @@`
+	Bytes          *ByteRangeMatch           `| "bytes" @@`
+	Packets        *PacketRangeMatch         `| "packets" @@`
+	FlowDirection  *FlowDirectionMatch       `| "direction"? @@`
+	Normalized     *NormalizedMatch          `| @@`
+	Duration       *DurationRangeMatch       `| "duration" @@`
+	Etype          *EtypeMatch               `| "etype" @@`
+	Proto          *ProtoMatch               `| "proto" @@`
+	Status         *StatusMatch              `| "status" @@`
+	TcpFlags       *TcpFlagsMatch            `| "tcpflags" @@`
+	IpTos          *IpTosRangeMatch          `| "iptos" @@`
+	Dscp           *DscpMatch                `| "dscp" @@`
+	Ecn            *EcnMatch                 `| "ecn" @@`
+	SamplingRate   *SamplingRateRangeMatch   `| "samplingrate" @@`
+	Icmp           *IcmpMatch                `| @@`
+	Bps            *BpsRangeMatch            `| "bps" @@`
+	Pps            *PpsRangeMatch            `| "pps" @@`
+	PassesThrough  *PassesThroughListMatch   `| "passes-through" @@`
+	Med            *MedRangeMatch            `| "med" @@`
+	LocalPref      *LocalPrefRangeMatch      `| "localpref" @@`
+	Mpls           *MplsMatch                `| "mpls" @@`
+	Encap          *EncapMatch               `| "encap" @@` // lexed as a protocol
+	Ttl            *TtlRangeMatch            `| "ttl" @@`
+	FlowLabel      *FlowLabelRangeMatch      `| "flowlabel" @@`
+	FragmentId     *FragmentIdRangeMatch     `| "fragment-id" @@`
+	FragmentOffset *FragmentOffsetRangeMatch `| "fragment-offset" @@`
+	Fragment       *FragmentMatch            `| @@`
+	FlowType       *FlowTypeMatch            `| "type" @@`
+	Age            *AgeRangeMatch            `| "age" @@`
+	SequenceNum    *SequenceNumRangeMatch    `| "sequence" @@`
+	AsPath         *AsPathMatch              `| "aspath" @@`
+	Time           *TimeMatch                `| @@`
+	Has            *HasMatch                 `| ("has"|"exists") @@`
 }
 
 func (o RegularMatchGroup) children() []Node {
-	return []Node{o.Router, o.NextHop, o.NextHopAsn, o.Bytes, o.Packets, o.RemoteCountry,
+	return []Node{o.Router, o.NextHop, o.NextHopAsn, o.Bytes, o.Packets,
 		o.FlowDirection, o.Normalized, o.Duration, o.Etype, o.Proto,
 		o.Status, o.TcpFlags, o.IpTos, o.Dscp, o.Ecn, o.SamplingRate,
-		o.Icmp, o.Bps, o.Pps, o.PassesThrough, o.Med, o.LocalPref, o.Rpki}
+		o.Icmp, o.Bps, o.Pps, o.PassesThrough, o.Med, o.LocalPref, o.Mpls,
+		o.Encap, o.Ttl, o.FlowLabel, o.FragmentId, o.FragmentOffset,
+		o.Fragment, o.FlowType, o.Age, o.SequenceNum, o.AsPath, o.Time,
+		o.Has}
 }
 
 type RouterMatch struct {
 	BranchNode
-	Address *net.IP `@Address`
+	Addresses []*AddressPrefix `  "{" @@ ( "," @@ )* "}"`
+	Address   *AddressPrefix   `| @@`
 }
 
-func (o RouterMatch) children() []Node { return nil }
+func (o RouterMatch) children() []Node {
+	nodes := []Node{o.Address}
+	for _, address := range o.Addresses {
+		nodes = append(nodes, address)
+	}
+	return nodes
+}
 
 type NextHopMatch struct {
+	BranchNode
+	Addresses []*AddressPrefix `  "{" @@ ( "," @@ )* "}"`
+	Address   *AddressPrefix   `| @@`
+}
+
+func (o NextHopMatch) children() []Node {
+	nodes := []Node{o.Address}
+	for _, address := range o.Addresses {
+		nodes = append(nodes, address)
+	}
+	return nodes
+}
+
+// AddressPrefix matches an address, or any address in its network if a mask
+// is given.
+type AddressPrefix struct {
 	BranchNode
 	Address *net.IP `@Address`
+	Mask    *Number `( "/" @Number)?`
 }
 
-func (o NextHopMatch) children() []Node { return nil }
+func (o AddressPrefix) children() []Node { return nil }
 
 type NextHopAsnMatch struct {
 	BranchNode
@@ -141,16 +323,16 @@ type NextHopAsnMatch struct {
 
 func (o NextHopAsnMatch) children() []Node { return nil }
 
-type ByteRangeMatch struct{ NumericRange }
-
-type PacketRangeMatch struct{ NumericRange }
-
-type RemoteCountryMatch struct {
-	BranchNode
-	CountryCode *String `@CountryCode`
+// ScaledRange is a NumericRange on a sampled counter, which can refer to the
+// counter multiplied by the flow's sampling rate instead, i.e. `scaled >1G`.
+type ScaledRange struct {
+	Scaled bool `@"scaled"?`
+	NumericRange
 }
 
-func (o RemoteCountryMatch) children() []Node { return nil }
+type ByteRangeMatch struct{ ScaledRange }
+
+type PacketRangeMatch struct{ ScaledRange }
 
 type FlowDirectionMatch struct {
 	BranchNode
@@ -171,7 +353,7 @@ type DurationRangeMatch struct{ NumericRange }
 type EtypeMatch struct {
 	BranchNode
 	Etype    *Number   `  @Number`
-	EtypeKey *EtypeKey `| @EtypeMagic`
+	EtypeKey *EtypeKey `| @(EtypeMagic|ProtoMagic)` // 'ipv4' and 'ipv6' are protocols too
 }
 
 func (o EtypeMatch) children() []Node {
@@ -183,7 +365,11 @@ type EtypeKey Number
 func (o EtypeKey) children() []Node { return nil }
 
 func (o *EtypeKey) Capture(values []string) error {
-	*o = EtypeKey(EtypeMagicMap[values[0]])
+	etype, ok := EtypeMagicMap[values[0]]
+	if !ok {
+		return fmt.Errorf("unknown etype %q", values[0])
+	}
+	*o = EtypeKey(etype)
 	return nil
 }
 
@@ -202,18 +388,49 @@ type ProtoKey Number
 func (o ProtoKey) children() []Node { return nil }
 
 func (o *ProtoKey) Capture(values []string) error {
-	*o = ProtoKey(ProtoMagicMap[values[0]])
+	if proto, ok := ProtoMagicMap[values[0]]; ok {
+		*o = ProtoKey(proto)
+	} else {
+		*o = ProtoKey(ProtoAliasMap[values[0]])
+	}
 	return nil
 }
 
+// Status matches either select a class, i.e. the first two bits, or a
+// specific reason, i.e. the exact value of the forwarding status.
 type StatusMatch struct {
 	BranchNode
-	Status    *Number    `  @Number`
-	StatusKey *StatusKey `| @StatusMagic`
+	StatusClass *StatusClass        `  "class"? @("unknown"|"forwarded"|"dropped"|"consumed")`
+	Statuses    []*StatusRangeMatch `| "reason"? "{" @@ ( "," @@ )* "}"`
+	Status      *StatusRangeMatch   `| "reason"? @@`
 }
 
 func (o StatusMatch) children() []Node {
-	return []Node{o.Status, o.StatusKey}
+	nodes := []Node{o.StatusClass, o.Status}
+	for _, status := range o.Statuses {
+		nodes = append(nodes, status)
+	}
+	return nodes
+}
+
+type StatusClass Number
+
+func (o StatusClass) children() []Node { return nil }
+
+func (o *StatusClass) Capture(values []string) error {
+	*o = StatusClass(StatusClassMagicMap[values[0]])
+	return nil
+}
+
+type StatusRangeMatch struct {
+	BranchNode
+	Lower     *StatusKey `  ( @(StatusMagic|Number) "-"`
+	Upper     *StatusKey `    @(StatusMagic|Number) )`
+	StatusKey *StatusKey `| @(StatusMagic|Number)`
+}
+
+func (o StatusRangeMatch) children() []Node {
+	return []Node{o.Lower, o.Upper, o.StatusKey}
 }
 
 type StatusKey Number
@@ -221,18 +438,36 @@ type StatusKey Number
 func (o StatusKey) children() []Node { return nil }
 
 func (o *StatusKey) Capture(values []string) error {
-	*o = StatusKey(StatusMagicMap[values[0]])
+	if status, ok := StatusMagicMap[values[0]]; ok {
+		*o = StatusKey(status)
+	} else if status, ok := StatusAliasMap[values[0]]; ok {
+		*o = StatusKey(status)
+	} else if status, err := strconv.ParseUint(values[0], 0, 8); err == nil {
+		*o = StatusKey(status)
+	} else {
+		return fmt.Errorf("bad status reason %q", values[0])
+	}
 	return nil
 }
 
+// TCP flag matches compare the flags of a flow against a mask. The optional
+// quantifier selects whether any, all, none or only the masked flags need to
+// be set, the mask is the union of all given flags. Without a quantifier,
+// numbers match exactly and magic strings require all their flags to be set.
 type TcpFlagsMatch struct {
 	BranchNode
-	TcpFlags    *Number      `  @Number`
-	TcpFlagsKey *TcpFlagsKey `| @TcpFlagsMagic`
+	Quantifier   *String        `@("any"|"all"|"none"|"only")? (`
+	TcpFlags     *Number        `  @Number`
+	TcpFlagsKeys []*TcpFlagsKey `| "{" @TcpFlagsMagic ( "," @TcpFlagsMagic )* "}"`
+	TcpFlagsKey  *TcpFlagsKey   `| @TcpFlagsMagic )`
 }
 
 func (o TcpFlagsMatch) children() []Node {
-	return []Node{o.TcpFlags, o.TcpFlagsKey}
+	nodes := []Node{o.Quantifier, o.TcpFlags, o.TcpFlagsKey}
+	for _, key := range o.TcpFlagsKeys {
+		nodes = append(nodes, key)
+	}
+	return nodes
 }
 
 type TcpFlagsKey Number
@@ -248,12 +483,15 @@ type IpTosRangeMatch struct{ NumericRange }
 
 type DscpMatch struct {
 	BranchNode
-	Dscp    *Number  `  @Number` // first 6 bits of iptos
-	DscpKey *DscpKey `| @DscpMagic`
+	Lower     *DscpKey   `  ( @(DscpMagic|Number) "-"` // first 6 bits of iptos
+	Upper     *DscpKey   `    @(DscpMagic|Number) )`
+	DscpClass *DscpClass `| @DscpClassMagic`
+	Dscp      *Number    `| @Number`
+	DscpKey   *DscpKey   `| @DscpMagic`
 }
 
 func (o DscpMatch) children() []Node {
-	return []Node{o.Dscp, o.DscpKey}
+	return []Node{o.Lower, o.Upper, o.DscpClass, o.Dscp, o.DscpKey}
 }
 
 type DscpKey Number
@@ -261,14 +499,33 @@ type DscpKey Number
 func (o DscpKey) children() []Node { return nil }
 
 func (o *DscpKey) Capture(values []string) error {
-	*o = DscpKey(DscpMagicMap[values[0]])
+	if dscp, ok := DscpMagicMap[values[0]]; ok {
+		*o = DscpKey(dscp)
+	} else if dscp, ok := DscpAliasMap[values[0]]; ok {
+		*o = DscpKey(dscp)
+	} else if dscp, err := strconv.ParseUint(values[0], 0, 6); err == nil {
+		*o = DscpKey(dscp) // range ends may be given as numbers
+	} else {
+		return fmt.Errorf("bad dscp %q", values[0])
+	}
+	return nil
+}
+
+// An Assured Forwarding class, matching all of its drop precedences.
+type DscpClass Number
+
+func (o DscpClass) children() []Node { return nil }
+
+func (o *DscpClass) Capture(values []string) error {
+	*o = DscpClass(DscpClassMagicMap[values[0]])
 	return nil
 }
 
 type EcnMatch struct {
 	BranchNode
-	Ecn    *Number `  @Number` // last 2 bits of iptos
-	EcnKey *EcnKey `| @EcnMagic`
+	Ecn     *Number `  @Number` // last 2 bits of iptos
+	EcnKey  *EcnKey `| @EcnMagic`
+	Capable bool    `| @"capable"`
 }
 
 func (o EcnMatch) children() []Node {
@@ -288,19 +545,70 @@ type SamplingRateRangeMatch struct{ NumericRange }
 
 type CidRangeMatch struct{ NumericRange }
 
+// CustomerMatches refer to customer IDs by customer name, i.e. `customer
+// "Uni Stuttgart"`, or by a regular expression on names, i.e. `customer ~
+// "^HS-"`. The IDs are resolved using Customers after parsing.
+type CustomerMatch struct {
+	BranchNode
+	Regex bool   `@"~"?`
+	Name  string `@String`
+	Cids  []uint32
+}
+
+func (o CustomerMatch) children() []Node { return nil }
+
+// ICMP matches work for both ICMP and ICMPv6, which message names are
+// available depends on the version.
 type IcmpMatch struct {
 	BranchNode
-	Type *Number `  ( "type" @Number )`
-	Code *Number `| ( "code" @Number )`
+	Version  *String         `@("icmp"|"icmpv6") (`
+	TypeName *IcmpMessage    `  "type" @@`
+	Type     *IcmpRangeMatch `| "type" @@`
+	Code     *IcmpRangeMatch `| "code" @@`
+	Messages []*IcmpMessage  `| "{" @@ ( "," @@ )* "}"`
+	Message  *IcmpMessage    `| @@ )`
 }
 
 func (o IcmpMatch) children() []Node {
-	return []Node{o.Type, o.Code}
+	nodes := []Node{o.Version, o.TypeName, o.Type, o.Code, o.Message}
+	for _, message := range o.Messages {
+		nodes = append(nodes, message)
+	}
+	return nodes
 }
 
-type BpsRangeMatch struct{ NumericRange }
+type IcmpRangeMatch struct {
+	BranchNode
+	Ranges []*NumericRange `  "{" @@ ( "," @@ )* "}"`
+	Range  *NumericRange   `| @@`
+}
 
-type PpsRangeMatch struct{ NumericRange }
+func (o IcmpRangeMatch) children() []Node {
+	nodes := []Node{o.Range}
+	for _, r := range o.Ranges {
+		nodes = append(nodes, r)
+	}
+	return nodes
+}
+
+// A message is either a type name, a code name, or a type name followed by
+// one of its code names. Type and code are resolved when parsing, the code
+// is nil for type names.
+type IcmpMessage struct {
+	BranchNode
+	Name     *String `@IcmpMagic`
+	CodeName *String `@IcmpMagic?`
+	Type     uint32
+	Code     *uint32
+}
+
+func (o IcmpMessage) children() []Node {
+	return []Node{o.Name, o.CodeName}
+}
+
+type BpsRangeMatch struct{ ScaledRange }
+
+type PpsRangeMatch struct{ ScaledRange }
 
 type PassesThroughListMatch struct {
 	BranchNode
@@ -309,6 +617,93 @@ type PassesThroughListMatch struct {
 
 func (o PassesThroughListMatch) children() []Node { return nil }
 
+type AsPathMatch struct {
+	BranchNode
+	Regex           *AsPathRegex            `  "~" @String`
+	Length          *AsPathLengthRangeMatch `| "length" @@`
+	Origin          *AsPathOriginRangeMatch `| "origin" @@`
+	First           *AsPathFirstRangeMatch  `| "first" @@`
+	Prepended       bool                    `| @"prepended"`
+	ContainsPrivate bool                    `| @"contains-private"`
+}
+
+func (o AsPathMatch) children() []Node {
+	return []Node{o.Regex, o.Length, o.Origin, o.First}
+}
+
+type AsPathLengthRangeMatch struct{ NumericRange }
+
+type AsPathOriginRangeMatch struct{ NumericRange }
+
+type AsPathFirstRangeMatch struct{ NumericRange }
+
+// HasMatches check whether a flow carries a field filled by enrichment, i.e.
+// `has country` or `has src iface name`. The field is checked after parsing.
+type HasMatch struct {
+	BranchNode
+	Direction *String `@("src"|"dst")?`
+	Field     *String `@(Match|Identifier)`
+	Subfield  *String `@IfaceSubcommands?`
+}
+
+func (o HasMatch) children() []Node {
+	return []Node{o.Direction, o.Field, o.Subfield}
+}
+
+// Name returns the name of the field as used by PresenceFields.
+func (o HasMatch) Name() string {
+	name := strings.ToLower(string(*o.Field))
+	if name == "interface" {
+		name = "iface"
+	}
+	if o.Direction != nil {
+		name = string(*o.Direction) + " " + name
+	}
+	if o.Subfield != nil {
+		name += " " + string(*o.Subfield)
+	}
+	return name
+}
+
+// TimeMatches refer to one of a flow's timestamps, which is its start unless
+// `end` or `received` is given.
+type TimeMatch struct {
+	BranchNode
+	Field     *String         `@("start"|"end"|"received")? (`
+	TimeOfDay *TimeOfDayRange `  "time" @@`
+	Weekdays  *WeekdayRange   `| "weekday" @(Identifier|ProtoMagic)` // `sat-mon` is a protocol
+	After     *Timestamp      `| "after" @Timestamp`
+	Before    *Timestamp      `| "before" @Timestamp`
+	Within    *Duration       `| "within" @Duration )`
+	Location  *Location       `("in" @String)?`
+}
+
+func (o TimeMatch) children() []Node {
+	return []Node{o.Field, o.TimeOfDay, o.Weekdays, o.After, o.Before,
+		o.Within, o.Location}
+}
+
+// TimeOfDayRange is a half-open range of wall clock time, which wraps around
+// midnight if its upper end is before its lower one, i.e. `22:00-06:00`.
+// Times of day not starting with 0 lex as addresses.
+type TimeOfDayRange struct {
+	BranchNode
+	Lower *TimeOfDay `@(TimeOfDay|Address)`
+	Upper *TimeOfDay `"-" @(TimeOfDay|Address)`
+}
+
+func (o TimeOfDayRange) children() []Node {
+	return []Node{o.Lower, o.Upper}
+}
+
+// Contains returns whether a time of day is part of the range.
+func (o TimeOfDayRange) Contains(t TimeOfDay) bool {
+	if *o.Lower <= *o.Upper {
+		return *o.Lower <= t && t < *o.Upper
+	}
+	return t >= *o.Lower || t < *o.Upper
+}
+
 type MedRangeMatch struct{ NumericRange }
 
 type LocalPrefRangeMatch struct{ NumericRange }
@@ -331,6 +726,101 @@ func (o *RpkiKey) Capture(values []string) error {
 	return nil
 }
 
+type MplsMatch struct {
+	BranchNode
+	Present  bool                 `  @"present"`
+	Depth    *MplsDepthRangeMatch `| "depth" @@`
+	Position *String              `| ( @("top"|"bottom")?`
+	Label    *MplsLabelRangeMatch `    ( "label" @@`
+	Ttl      *MplsTtlRangeMatch   `    | "ttl" @@ ) )`
+}
+
+func (o MplsMatch) children() []Node {
+	return []Node{o.Depth, o.Position, o.Label, o.Ttl}
+}
+
+type MplsDepthRangeMatch struct{ NumericRange }
+
+type MplsLabelRangeMatch struct{ NumericRange }
+
+type MplsTtlRangeMatch struct{ NumericRange }
+
+// EncapMatch re-targets its matches at the innermost IP header of tunneled
+// traffic. Inner addresses are not supported, as the flow format does not
+// carry them.
+type EncapMatch struct {
+	BranchNode
+	Present bool        `  @"present"`
+	Etype   *EtypeMatch `| "etype" @@`
+	Proto   *ProtoMatch `| "proto" @@`
+}
+
+func (o EncapMatch) children() []Node {
+	return []Node{o.Etype, o.Proto}
+}
+
+type TtlRangeMatch struct{ NumericRange }
+
+type FlowLabelRangeMatch struct{ NumericRange }
+
+type FragmentIdRangeMatch struct{ NumericRange }
+
+type FragmentOffsetRangeMatch struct{ NumericRange }
+
+type FragmentMatch struct {
+	BranchNode
+	Fragment *String `@("fragment"|"first-fragment"|"non-first-fragment")`
+}
+
+func (o FragmentMatch) children() []Node {
+	return []Node{o.Fragment}
+}
+
+type FlowTypeMatch struct {
+	BranchNode
+	FlowType     *Number        `  @Number`
+	FlowTypeKeys []*FlowTypeKey `| "{" @FlowTypeMagic ( "," @FlowTypeMagic )* "}"`
+	FlowTypeKey  *FlowTypeKey   `| @FlowTypeMagic`
+}
+
+func (o FlowTypeMatch) children() []Node {
+	nodes := []Node{o.FlowType, o.FlowTypeKey}
+	for _, key := range o.FlowTypeKeys {
+		nodes = append(nodes, key)
+	}
+	return nodes
+}
+
+type FlowTypeKey Number
+
+func (o FlowTypeKey) children() []Node { return nil }
+
+func (o *FlowTypeKey) Capture(values []string) error {
+	*o = FlowTypeKey(FlowTypeMagicMap[values[0]])
+	return nil
+}
+
+// AgeRangeMatch is a NumericRange of seconds, whose bounds may be given as
+// durations as well, i.e. `>5m` or `1h-1d`.
+type AgeRangeMatch struct {
+	BranchNode
+	Lower  *Number   `((@(Number|Duration)`
+	Upper  *RangeEnd `"-" @(Number|Duration)) |`
+	Unary  *String   `( @Unary?`
+	Number *Number   `  @(Number|Duration) ))`
+}
+
+func (o AgeRangeMatch) children() []Node {
+	return []Node{o.Lower, o.Upper, o.Unary, o.Number}
+}
+
+// NumericRange returns the range in seconds.
+func (o AgeRangeMatch) NumericRange() NumericRange {
+	return NumericRange{Lower: o.Lower, Upper: o.Upper, Unary: o.Unary, Number: o.Number}
+}
+
+type SequenceNumRangeMatch struct{ NumericRange }
+
 // Directional Matches:
 // * anything that has further sub commands or accepts fancy data
 // * no direction
@@ -340,16 +830,24 @@ type DirectionalMatchGroup struct {
 	Direction *String            `@Direction?`
 	Address   *AddressMatch      `( "address" @@`
 	Interface *InterfaceMatch    `| ("iface"|"interface") @@`
-	Port      *PortRangeMatch    `| "port" @@`
+	Port      *PortMatch         `| "port" @@`
 	Asn       *AsnRangeMatch     `| "asn" @@`
 	Netsize   *NetsizeRangeMatch `| "netsize" @@`
 	Cid       *CidRangeMatch     `| "cid" @@`
-	Vrf       *VrfRangeMatch     `| "vrf" @@ )`
+	Vrf       *VrfRangeMatch     `| "vrf" @@`
+	Mac       *MacMatch          `| "mac" @@`
+	Vlan      *VlanRangeMatch    `| "vlan" @@`
+	Country   *CountryMatch      `| "country" @@`
+	Continent *ContinentMatch    `| "continent" @@`
+	Rpki      *RpkiMatch         `| "rpki" @@`
+	Prefix    *PrefixMatch       `| "prefix" @@`
+	Customer  *CustomerMatch     `| "customer" @@ )`
 }
 
 func (o DirectionalMatchGroup) children() []Node {
 	return []Node{o.Direction, o.Address, o.Interface, o.Port, o.Asn,
-		o.Netsize, o.Cid, o.Vrf}
+		o.Netsize, o.Cid, o.Vrf, o.Mac, o.Vlan, o.Country, o.Continent, o.Rpki, o.Prefix,
+		o.Customer}
 }
 
 type AddressMatch struct {
@@ -360,24 +858,204 @@ type AddressMatch struct {
 
 func (o AddressMatch) children() []Node { return nil }
 
+// PrefixMatches compare the routed prefix of a flow's address, which is the
+// address masked to its netsize, to a prefix as router prefix lists do. The
+// routed prefix has to equal it by default or when `exact` is given, or has
+// to be inside it and at least as long for `orlonger`, longer for `longer`,
+// or at most as long as `upto` allows. The lengths are checked after parsing.
+type PrefixMatch struct {
+	BranchNode
+	Address  *net.IP `@Address`
+	Mask     *Number `"/" @Number`
+	Exact    bool    `( @"exact"`
+	OrLonger bool    `| @"orlonger"`
+	Longer   bool    `| @"longer"`
+	UpTo     *Number `| "upto" "/" @Number )?`
+}
+
+func (o PrefixMatch) children() []Node { return nil }
+
+// Bits returns the length of the prefix's address family.
+func (o PrefixMatch) Bits() int {
+	if o.Address.To4() != nil {
+		return 32
+	}
+	return 128
+}
+
 type InterfaceMatch struct {
 	BranchNode
-	SnmpId      *Number            `  (   "id"? @Number )`
+	SnmpIds     []*InterfaceKey    `  (   "id"? "{" @@ ( "," @@ )* "}" )`
+	SnmpId      *InterfaceKey      `| (   "id"? @@ )`
 	Name        *String            `| ( "name"  @String )`
 	Description *String            `| ( "desc"  @String )`
 	Speed       *IfSpeedRangeMatch `| ("speed"  @@)`
 }
 
 func (o InterfaceMatch) children() []Node {
-	return []Node{o.SnmpId, o.Name, o.Description, o.Speed}
+	nodes := []Node{o.SnmpId, o.Name, o.Description, o.Speed}
+	for _, key := range o.SnmpIds {
+		nodes = append(nodes, key)
+	}
+	return nodes
+}
+
+// InterfaceKeys identify an interface by its SNMP ID, i.e. `5`. As SNMP IDs
+// are unique per router only, they can be scoped to the router exporting a
+// flow, i.e. `5 on router 10.0.0.1`, or `10.0.0.1:5` for IPv4 routers.
+type InterfaceKey struct {
+	Scoped *ScopedInterface `  @Address`
+	SnmpId *Number          `| ( @Number`
+	Router *net.IP          `    ( "on" "router" @Address )? )`
+}
+
+func (o InterfaceKey) children() []Node { return nil }
+
+// Key returns the SNMP ID of the interface and its router, which is nil
+// unless the key is scoped to one.
+func (o InterfaceKey) Key() (uint32, net.IP) {
+	if o.Scoped != nil {
+		return o.Scoped.SnmpId, o.Scoped.Router
+	}
+	if o.Router != nil {
+		return uint32(*o.SnmpId), *o.Router
+	}
+	return uint32(*o.SnmpId), nil
+}
+
+// ScopedInterface is the combined notation `router:ifindex` of an interface
+// on an IPv4 router. IPv6 addresses are ambiguous in it.
+type ScopedInterface struct {
+	Router net.IP
+	SnmpId uint32
+}
+
+func (o *ScopedInterface) Capture(values []string) error {
+	address, id, ok := strings.Cut(values[0], ":")
+	router := net.ParseIP(address).To4()
+	if !ok || router == nil {
+		return fmt.Errorf("bad interface %q, expected `<router>:<id>` for IPv4 routers or `<id> on router <router>`", values[0])
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return fmt.Errorf("bad interface id %q", id)
+	}
+	*o = ScopedInterface{Router: router, SnmpId: uint32(n)}
+	return nil
 }
 
 type IfSpeedRangeMatch struct{ NumericRange }
 
-type PortRangeMatch struct{ NumericRange }
+type PortMatch struct {
+	BranchNode
+	Ports []*PortRangeMatch `  "{" @@ ( "," @@ )* "}"`
+	Port  *PortRangeMatch   `| @@`
+}
+
+func (o PortMatch) children() []Node {
+	nodes := []Node{o.Port}
+	for _, port := range o.Ports {
+		nodes = append(nodes, port)
+	}
+	return nodes
+}
+
+type PortRangeMatch struct {
+	BranchNode
+	ServiceKey *ServiceKey   `  @(Identifier|ProtoMagic)` // 'l2tp' and 'rdp' are protocols too
+	Range      *NumericRange `| @@`
+}
+
+func (o PortRangeMatch) children() []Node {
+	return []Node{o.ServiceKey, o.Range}
+}
+
+type ServiceKey Number
+
+func (o ServiceKey) children() []Node { return nil }
+
+func (o *ServiceKey) Capture(values []string) error {
+	if port, ok := ServiceMagicMap[values[0]]; ok {
+		*o = ServiceKey(port)
+	} else if port, ok := ServiceAliasMap[values[0]]; ok {
+		*o = ServiceKey(port)
+	} else {
+		return fmt.Errorf("unknown service %q", values[0])
+	}
+	return nil
+}
 
 type AsnRangeMatch struct{ NumericRange }
 
 type NetsizeRangeMatch struct{ NumericRange }
 
 type VrfRangeMatch struct{ NumericRange }
+
+type MacMatch struct {
+	BranchNode
+	MacClass *String     `  @("broadcast"|"multicast")`
+	Mac      *MacAddress `| @(Mac|Address)`
+}
+
+func (o MacMatch) children() []Node {
+	return []Node{o.MacClass, o.Mac}
+}
+
+// MacAddress is a full mac address or, if it has less than six octets, the
+// prefix of one, i.e. an OUI.
+type MacAddress net.HardwareAddr
+
+func (o MacAddress) children() []Node { return nil }
+
+func (o *MacAddress) Capture(values []string) error {
+	prefix, ok := strings.CutSuffix(values[0], "*")
+	if !ok {
+		mac, err := net.ParseMAC(values[0])
+		if err != nil || len(mac) != 6 {
+			return fmt.Errorf("bad mac address %q", values[0])
+		}
+		*o = MacAddress(mac)
+		return nil
+	}
+	octets := strings.FieldsFunc(prefix, func(r rune) bool { return r == ':' || r == '-' })
+	mac := make(MacAddress, len(octets))
+	for i, octet := range octets {
+		value, err := strconv.ParseUint(octet, 16, 8)
+		if err != nil {
+			return fmt.Errorf("bad mac prefix %q", values[0])
+		}
+		mac[i] = byte(value)
+	}
+	*o = mac
+	return nil
+}
+
+type VlanRangeMatch struct{ NumericRange }
+
+type CountryMatch struct {
+	BranchNode
+	Countries []*CountryCode `  "{" @(CountryCode|ProtoMagic|DscpMagic) ( "," @(CountryCode|ProtoMagic|DscpMagic) )* "}"` // some codes are protocols or dscp too
+	Country   *CountryCode   `| @(CountryCode|ProtoMagic|DscpMagic)`
+}
+
+func (o CountryMatch) children() []Node {
+	nodes := []Node{o.Country}
+	for _, country := range o.Countries {
+		nodes = append(nodes, country)
+	}
+	return nodes
+}
+
+type ContinentMatch struct {
+	BranchNode
+	Continents []*Continent `  "{" @Identifier ( "," @Identifier )* "}"`
+	Continent  *Continent   `| @Identifier`
+}
+
+func (o ContinentMatch) children() []Node {
+	nodes := []Node{o.Continent}
+	for _, continent := range o.Continents {
+		nodes = append(nodes, continent)
+	}
+	return nodes
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CustomerDirectory resolves the names used by customer matches to customer
+// IDs, as found in the cid fields of flows.
+type CustomerDirectory interface {
+	// Customers returns the IDs of all customers by name.
+	Customers() map[string][]uint32
+}
+
+// Customers is the directory customer matches are resolved with when
+// parsing. Without one, all customer matches fail to parse. This is not safe
+// to set while other goroutines parse.
+var Customers CustomerDirectory
+
+// CustomerMap is a CustomerDirectory kept in memory. A customer may have
+// multiple IDs.
+type CustomerMap map[string][]uint32
+
+func (m CustomerMap) Customers() map[string][]uint32 { return m }
+
+// ReadCustomers reads a CustomerMap from a CSV file with the columns `cid`
+// and `name`, or from a YAML file containing a list of objects with the keys
+// `cid` and `name`, as indicated by a `.yaml` or `.yml` extension. A CSV
+// header row is optional.
+func ReadCustomers(filename string) (CustomerMap, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	customers := make(CustomerMap)
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		var entries []struct {
+			Cid  uint32 `yaml:"cid"`
+			Name string `yaml:"name"`
+		}
+		if err := yaml.NewDecoder(file).Decode(&entries); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		for i, entry := range entries {
+			if entry.Name == "" {
+				return nil, fmt.Errorf("%s: entry %d: missing name", filename, i+1)
+			}
+			customers[entry.Name] = append(customers[entry.Name], entry.Cid)
+		}
+	default:
+		reader := csv.NewReader(file)
+		reader.Comment = '#'
+		reader.FieldsPerRecord = 2
+		reader.TrimLeadingSpace = true
+		for first := true; ; first = false {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+			if first && strings.EqualFold(record[0], "cid") {
+				continue
+			}
+			cid, err := strconv.ParseUint(record[0], 10, 32)
+			if err != nil {
+				lineno, _ := reader.FieldPos(0)
+				return nil, fmt.Errorf("%s:%d: bad cid %q", filename, lineno, record[0])
+			}
+			customers[record[1]] = append(customers[record[1]], uint32(cid))
+		}
+	}
+	return customers, nil
+}
+
+// LoadCustomers sets Customers from a file, see ReadCustomers. This is not
+// safe to call while other goroutines parse.
+func LoadCustomers(filename string) error {
+	customers, err := ReadCustomers(filename)
+	if err != nil {
+		return err
+	}
+	Customers = customers
+	return nil
+}
+
+// resolveCustomers sets the IDs of a customer match from Customers. Names
+// and regular expressions which do not resolve to any ID are an error.
+func resolveCustomers(node *CustomerMatch) error {
+	if Customers == nil {
+		return fmt.Errorf("no customer directory to resolve %q", node.Name)
+	}
+	var match func(name string) bool
+	if node.Regex {
+		re, err := regexp.Compile(node.Name)
+		if err != nil {
+			return fmt.Errorf("bad customer regex %q: %w", node.Name, err)
+		}
+		match = re.MatchString
+	} else {
+		match = func(name string) bool { return name == node.Name }
+	}
+
+	node.Cids = nil
+	for name, cids := range Customers.Customers() {
+		if match(name) {
+			node.Cids = append(node.Cids, cids...)
+		}
+	}
+	if len(node.Cids) == 0 {
+		return fmt.Errorf("unknown customer %q", node.Name)
+	}
+	slices.Sort(node.Cids)
+	node.Cids = slices.Compact(node.Cids)
+	return nil
+}
@@ -0,0 +1,119 @@
+package parser
+
+import "fmt"
+
+// FieldType is the type of a flow field, as far as comparisons are concerned.
+type FieldType int
+
+const (
+	NumberField FieldType = iota
+	AddressField
+	MacField
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case AddressField:
+		return "address"
+	case MacField:
+		return "mac"
+	}
+	return "number"
+}
+
+var (
+	// The flow fields which can be referenced in comparisons, by their
+	// type. Directional fields are listed with their direction, fields
+	// without direction are matched case insensitively, i.e. `InIf`.
+	ComparableFields = map[string]FieldType{
+		"src address":   AddressField,
+		"dst address":   AddressField,
+		"src asn":       NumberField,
+		"dst asn":       NumberField,
+		"src port":      NumberField,
+		"dst port":      NumberField,
+		"src iface":     NumberField,
+		"dst iface":     NumberField,
+		"src netsize":   NumberField,
+		"dst netsize":   NumberField,
+		"src cid":       NumberField,
+		"dst cid":       NumberField,
+		"src vrf":       NumberField,
+		"dst vrf":       NumberField,
+		"src vlan":      NumberField,
+		"dst vlan":      NumberField,
+		"src mac":       MacField,
+		"dst mac":       MacField,
+		"inif":          NumberField,
+		"outif":         NumberField,
+		"router":        AddressField,
+		"nexthop":       AddressField,
+		"nexthopasn":    NumberField,
+		"bytes":         NumberField,
+		"packets":       NumberField,
+		"proto":         NumberField,
+		"etype":         NumberField,
+		"iptos":         NumberField,
+		"ttl":           NumberField,
+		"samplingrate":  NumberField,
+		"med":           NumberField,
+		"localpref":     NumberField,
+		"cid":           NumberField,
+		"vlan":          NumberField,
+		"timeflowstart": NumberField,
+		"timeflowend":   NumberField,
+		"timereceived":  NumberField,
+		"duration":      NumberField,
+	}
+)
+
+// sumType returns the type of an arithmetic expression, which is the type of
+// its field if it consists of a single one. Any arithmetic requires numbers.
+func sumType(sum *Sum) (FieldType, error) {
+	if field := sum.Field(); field != nil {
+		fieldType, ok := ComparableFields[field.Name()]
+		if !ok {
+			return 0, fmt.Errorf("unknown field %q", field.Name())
+		}
+		return fieldType, nil
+	}
+	return NumberField, Visit(sum, func(n Node, next func() error) error {
+		if field, ok := n.(*FieldRef); ok {
+			fieldType, ok := ComparableFields[field.Name()]
+			if !ok {
+				return fmt.Errorf("unknown field %q", field.Name())
+			} else if fieldType != NumberField {
+				return fmt.Errorf("can not use %s field %q in arithmetic", fieldType, field.Name())
+			}
+		}
+		return next()
+	})
+}
+
+var (
+	// The flow fields which are filled by enrichment and can be checked for
+	// presence using `has`.
+	PresenceFields = map[string]bool{
+		"country":         true,
+		"src country":     true,
+		"dst country":     true,
+		"cid":             true,
+		"src cid":         true,
+		"dst cid":         true,
+		"src iface name":  true,
+		"dst iface name":  true,
+		"src iface desc":  true,
+		"dst iface desc":  true,
+		"src iface speed": true,
+		"dst iface speed": true,
+		"src asn":         true,
+		"dst asn":         true,
+		"nexthopasn":      true,
+		"aspath":          true,
+		"rpki":            true,
+		"src rpki":        true,
+		"dst rpki":        true,
+		"med":             true,
+		"localpref":       true,
+	}
+)
@@ -0,0 +1,117 @@
+package parser
+
+import "fmt"
+
+var (
+	// ICMP message names. Type names refer to all codes of their type,
+	// code names are unique and refer to a single type and code, encoded
+	// as type<<8|code, which is how Netflow v9 reports them as DstPort.
+	IcmpTypeMagicMap = map[string]uint64{ // explicit
+		"echo-reply":            0,
+		"dest-unreach":          3,
+		"source-quench":         4,
+		"redirect":              5,
+		"echo-request":          8,
+		"router-advert":         9,
+		"router-solicit":        10,
+		"time-exceeded":         11,
+		"param-problem":         12,
+		"timestamp-request":     13,
+		"timestamp-reply":       14,
+		"info-request":          15,
+		"info-reply":            16,
+		"mask-request":          17,
+		"mask-reply":            18,
+		"traceroute":            30,
+		"extended-echo-request": 42,
+		"extended-echo-reply":   43,
+	}
+	IcmpCodeMagicMap = map[string]uint64{ // explicit, type<<8|code
+		"net-unreach":          3<<8 | 0,
+		"host-unreach":         3<<8 | 1,
+		"proto-unreach":        3<<8 | 2,
+		"port-unreach":         3<<8 | 3,
+		"frag-needed":          3<<8 | 4,
+		"source-route-failed":  3<<8 | 5,
+		"net-unknown":          3<<8 | 6,
+		"host-unknown":         3<<8 | 7,
+		"host-isolated":        3<<8 | 8,
+		"net-prohibited":       3<<8 | 9,
+		"host-prohibited":      3<<8 | 10,
+		"net-tos-unreach":      3<<8 | 11,
+		"host-tos-unreach":     3<<8 | 12,
+		"admin-prohibited":     3<<8 | 13,
+		"precedence-violation": 3<<8 | 14,
+		"precedence-cutoff":    3<<8 | 15,
+		"redirect-net":         5<<8 | 0,
+		"redirect-host":        5<<8 | 1,
+		"redirect-tos-net":     5<<8 | 2,
+		"redirect-tos-host":    5<<8 | 3,
+		"ttl-exceeded":         11<<8 | 0,
+		"reassembly-exceeded":  11<<8 | 1,
+		"pointer-problem":      12<<8 | 0,
+		"option-missing":       12<<8 | 1,
+		"bad-length":           12<<8 | 2,
+	}
+	Icmpv6TypeMagicMap = map[string]uint64{ // explicit
+		"dest-unreach":     1,
+		"packet-too-big":   2,
+		"time-exceeded":    3,
+		"param-problem":    4,
+		"echo-request":     128,
+		"echo-reply":       129,
+		"mld-query":        130,
+		"mld-report":       131,
+		"mld-done":         132,
+		"router-solicit":   133,
+		"router-advert":    134,
+		"neighbor-solicit": 135,
+		"neighbor-advert":  136,
+		"redirect":         137,
+		"mld2-report":      143,
+	}
+	Icmpv6CodeMagicMap = map[string]uint64{ // explicit, type<<8|code
+		"no-route":            1<<8 | 0,
+		"admin-prohibited":    1<<8 | 1,
+		"beyond-scope":        1<<8 | 2,
+		"addr-unreach":        1<<8 | 3,
+		"port-unreach":        1<<8 | 4,
+		"failed-policy":       1<<8 | 5,
+		"reject-route":        1<<8 | 6,
+		"ttl-exceeded":        3<<8 | 0,
+		"reassembly-exceeded": 3<<8 | 1,
+		"pointer-problem":     4<<8 | 0,
+		"unrecognized-header": 4<<8 | 1,
+		"unrecognized-option": 4<<8 | 2,
+	}
+)
+
+// resolveIcmpMessage sets the type and code of a message using the names of
+// the given ICMP version. Unknown names and codes of other types are an error.
+func resolveIcmpMessage(version string, message *IcmpMessage) error {
+	typeMap, codeMap := IcmpTypeMagicMap, IcmpCodeMagicMap
+	if version == "icmpv6" {
+		typeMap, codeMap = Icmpv6TypeMagicMap, Icmpv6CodeMagicMap
+	}
+	name := string(*message.Name)
+	if code, ok := codeMap[name]; ok && message.CodeName == nil {
+		icmpCode := uint32(code & 0xff)
+		message.Type, message.Code = uint32(code>>8), &icmpCode
+		return nil
+	}
+	msgType, ok := typeMap[name]
+	if !ok {
+		return fmt.Errorf("unknown %s message %q", version, name)
+	}
+	message.Type, message.Code = uint32(msgType), nil
+	if message.CodeName == nil {
+		return nil
+	}
+	code, ok := codeMap[string(*message.CodeName)]
+	if !ok || code>>8 != msgType {
+		return fmt.Errorf("%q is no %s code of type %q", *message.CodeName, version, name)
+	}
+	icmpCode := uint32(code & 0xff)
+	message.Code = &icmpCode
+	return nil
+}
@@ -1,6 +1,11 @@
 package parser
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
 	"github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
 )
@@ -10,27 +15,40 @@ var (
 		// syntax connectors and negators
 		{Name: "Negation", Pattern: `\bnot\b`},
 		{Name: "Conjunction", Pattern: `\b(and|or)\b`},
+		// mac addresses in colon, dash or cisco notation, and prefixes thereof,
+		// colon notation lexes as address unless it starts with 0 or letters
+		// only, not to split IPv6 addresses like `10:20:30:40:50:60::1`
+		{Name: "Mac", Pattern: `\b[0-9a-fA-F]{2}(-[0-9a-fA-F]{2}){5}\b|\b(0[0-9a-fA-F]|[a-fA-F]{2})([:-][0-9a-fA-F]{2}){5}\b|\b[0-9a-fA-F]{4}(\.[0-9a-fA-F]{4}){2}\b|\b[0-9a-fA-F]{2}([:-][0-9a-fA-F]{2}){0,4}[:-]\*`}, // needs to be before 'ac', 'ef' and the like
+		// timestamps, which would lex as numbers otherwise
+		{Name: "Timestamp", Pattern: `\b\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2})?(Z|[+-]\d{2}:\d{2})?)?\b`},
 		// magic strings for different commands
-		{Name: "EcnMagic", Pattern: `\b(ce|ect1|ect0)\b`},
-		{Name: "DscpMagic", Pattern: `\b(default|besteffort)\b`},
+		{Name: "IcmpMagic", Pattern: magicPattern(IcmpTypeMagicMap, IcmpCodeMagicMap, Icmpv6TypeMagicMap, Icmpv6CodeMagicMap)}, // needs to be before 'unknown' and 'router'
+		{Name: "EcnMagic", Pattern: magicPattern(EcnMagicMap)},
+		{Name: "DscpMagic", Pattern: magicPattern(DscpMagicMap, DscpAliasMap)},
+		{Name: "DscpClassMagic", Pattern: magicPattern(DscpClassMagicMap)},
+		{Name: "ProtoMagic", Pattern: magicPattern(ProtoMagicMap, ProtoAliasMap)}, // needs to be before 'ipv6'
 		{Name: "EtypeMagic", Pattern: `\b(ipv6|ipv4|arp)\b`},
-		{Name: "ProtoMagic", Pattern: `\b(icmp|tcp|udp|icmpv6|ipip|vrrp)\b`},
-		{Name: "StatusMagic", Pattern: `\b(forwarded|dropped|acldeny|acldrop|unroutable|consumed|policerdrop)\b`},
-		{Name: "TcpFlagsMagic", Pattern: `\b(fin|syn|rst|psh|ack|urg|synack|cwr|ece)\b`},
+		{Name: "StatusMagic", Pattern: magicPattern(StatusMagicMap, StatusAliasMap, StatusClassMagicMap)},
+		{Name: "TcpFlagsMagic", Pattern: magicPattern(TcpFlagsMagicMap)},
 		{Name: "RpkiMagic", Pattern: `\b(valid|invalid|notfound|unknown)\b`},
+		{Name: "FlowTypeMagic", Pattern: magicPattern(FlowTypeMagicMap)},
 		// actual match keywords
-		{Name: "Direction", Pattern: `\b(src|dst)\b`},
-		{Name: "Match", Pattern: `\b(bytes|packets|port|asn|passes-through|interface|iface|address|router|country|direction|duration|etype|proto|status|tcpflags|iptos|dscp|ecn|nexthop|netsize|vrf|samplingrate|cid|icmp|bps|pps|med|localpref|rpki|nexthopasn)\b`},
-		{Name: "Standalone", Pattern: `\b(incoming|outgoing|normalized)\b`},
+		{Name: "Direction", Pattern: `\b(src|dst|local|remote|ingress|egress|both|either)\b`},
+		{Name: "Match", Pattern: `\b(bytes|packets|port|asn|passes-through|interface|iface|address|router|country|continent|direction|duration|etype|proto|status|tcpflags|iptos|dscp|ecn|nexthop|netsize|vrf|samplingrate|cid|icmp|bps|pps|med|localpref|rpki|prefix|customer|nexthopasn|mac|vlan|mpls|ttl|flowlabel|fragment-id|fragment-offset|age|sequence|aspath)\b`},
+		{Name: "Standalone", Pattern: `\b(incoming|outgoing|normalized|non-first-fragment|first-fragment|fragment)\b`},
 		// subcommands
 		{Name: "IfaceSubcommands", Pattern: `\b(name|desc|speed)\b`},
 		{Name: "IcmpSubcommands", Pattern: `\b(type|code)\b`},
 		// generic datatype-style tokens
-		{Name: "CountryCode", Pattern: `\b[a-zA-Z]{2}\b`}, // needs to be after 'or' and 'ce'
 		{Name: "Address", Pattern: `[1-9a-fA-F][0-9a-fA-F]*(\.|:)[0-9a-fA-F.:]+`},
-		{Name: "Number", Pattern: `[0-9a-fA-Fx]+`},
+		{Name: "TimeOfDay", Pattern: `\b` + timeOfDayPattern + `\b`},                                       // needs to be after 'Address', which takes those not starting with 0
+		{Name: "Identifier", Pattern: `\b[a-zA-Z]([a-zA-Z0-9]*(-[a-zA-Z0-9]+)+|[a-zA-Z0-9]{2,}|[0-9])?\b`}, // needs to be after 'Address', leaves two letter words to 'CountryCode'
+		{Name: "CountryCode", Pattern: `\b[a-zA-Z]{2}\b`},                                                  // needs to be after 'or' and 'ce'
+		{Name: "Duration", Pattern: `\b(\d+[smhdw])+\b`},
+		{Name: "Number", Pattern: `[0-9a-fA-Fx]+([kMGT]i?)?`},
+		{Name: "Comparator", Pattern: `==|!=|<=|>=`},
 		{Name: "Unary", Pattern: `<|>`},
-		{Name: "Symbol", Pattern: `-|/|\(|\)`},
+		{Name: "Symbol", Pattern: `-|/|\(|\)|\{|\}|,|~|\+|\*`},
 		{Name: "String", Pattern: `'[^']*'|"[^"]*"`},
 		{Name: "whitespace", Pattern: `[ \t]+`},
 	})
@@ -38,57 +56,55 @@ var (
 	parser = participle.MustBuild[Expression](
 		participle.Lexer(bpfLexer),
 		participle.Unquote("String"),
+		participle.UseLookahead(participle.MaxLookahead), // comparisons start like matches or subexpressions
 	)
 
 	EcnMagicMap = map[string]uint64{ // explicit
-		"ce":   0b11,
-		"ect1": 0b01,
-		"ect0": 0b10,
+		"notect": 0b00,
+		"ce":     0b11,
+		"ect1":   0b01,
+		"ect0":   0b10,
 	}
 	EtypeMagicMap = map[string]uint64{ // explicit
 		"ipv4": 0x0800,
 		"arp":  0x0806,
 		"ipv6": 0x86DD,
 	}
-	ProtoMagicMap = map[string]uint64{"icmp": 1, // explicit
-		"tcp":    6,
-		"udp":    17,
-		"icmpv6": 58,
-		"ipip":   94,
-		"vrrp":   112}
-	StatusMagicMap = map[string]uint64{ // mask
-		"forwarded":   0b01000000,
-		"dropped":     0b10000000,
-		"acldeny":     0b10000001,
-		"acldrop":     0b10000010,
-		"unroutable":  0b10000011,
-		"consumed":    0b11000000,
-		"policerdrop": 0b10001010,
-		// full list:
+	StatusClassMagicMap = map[string]uint64{ // explicit, first 2 bits
+		"unknown":   0b00,
+		"forwarded": 0b01,
+		"dropped":   0b10,
+		"consumed":  0b11,
+	}
+	StatusMagicMap = map[string]uint64{ // explicit
+		"fragmented":          0b01000001, // Forwarded (Fragmented)
+		"notfragmented":       0b01000010, // Forwarded (Not Fragmented)
+		"acldeny":             0b10000001, // Dropped (ACL Deny)
+		"acldrop":             0b10000010, // Dropped (ACL Drop)
+		"unroutable":          0b10000011, // Dropped (Unroutable)
+		"adjacency":           0b10000100, // Dropped (Adjacency)
+		"fragdf":              0b10000101, // Dropped (Fragmented and DF set)
+		"badchecksum":         0b10000110, // Dropped (Bad Header Checksum)
+		"badtotallength":      0b10000111, // Dropped (Bad Total Length)
+		"badheaderlength":     0b10001000, // Dropped (Bad Header Length)
+		"badttl":              0b10001001, // Dropped (Bad TTL)
+		"policer":             0b10001010, // Dropped (Policer)
+		"wred":                0b10001011, // Dropped (WRED)
+		"rpf":                 0b10001100, // Dropped (RPF)
+		"forus":               0b10001101, // Dropped (For Us)
+		"badoutif":            0b10001110, // Dropped (Bad Output Interface)
+		"hardware":            0b10001111, // Dropped (Hardware)
+		"puntadjacency":       0b11000001, // Consumed (Terminate Punt Adjacency)
+		"incompleteadjacency": 0b11000010, // Consumed (Terminate Incomplete Adjacency)
+		"terminateforus":      0b11000011, // Consumed (Terminate For Us)
+		// The remaining values are the unknown reason of each class:
 		// 0b00000000, Unknown
 		// 0b01000000, Forwarded (Unknown)
-		// 0b01000001, Forwarded (Fragmented)
-		// 0b01000010, Forwarded (Not Fragmented)
 		// 0b10000000, Dropped (Unknown)
-		// 0b10000001, Dropped (ACL Deny)
-		// 0b10000010, Dropped (ACL Drop)
-		// 0b10000011, Dropped (Unroutable)
-		// 0b10000100, Dropped (Adjacency)
-		// 0b10000101, Dropped (Fragmented and DF set)
-		// 0b10000110, Dropped (Bad Header Checksum)
-		// 0b10000111, Dropped (Bad Total Length)
-		// 0b10001000, Dropped (Bad Header Length)
-		// 0b10001001, Dropped (Bad TTL)
-		// 0b10001010, Dropped (Policer)
-		// 0b10001011, Dropped (WRED)
-		// 0b10001100, Dropped (RPF)
-		// 0b10001101, Dropped (For Us)
-		// 0b10001110, Dropped (Bad Output Interface)
-		// 0b10001111, Dropped (Hardware)
 		// 0b11000000, Consumed (Unknown)
-		// 0b11000001, Consumed (Terminate Punt Adjacency)
-		// 0b11000010, Consumed (Terminate Incomplete Adjacency)
-		// 0b11000011, Consumed (Terminate For Us)
+	}
+	StatusAliasMap = map[string]uint64{
+		"policerdrop": 0b10001010,
 	}
 	TcpFlagsMagicMap = map[string]uint64{ // mask
 		"fin":    0b000000001,
@@ -99,11 +115,50 @@ var (
 		"ack":    0b000010000,
 		"urg":    0b000100000,
 		"synack": 0b000010010,
+		"ece":    0b001000000, // was 0b100000000, the NS bit, by mistake
 		"cwr":    0b010000000,
-		"ece":    0b100000000,
 	}
 	DscpMagicMap = map[string]uint64{ // explicit
 		"default": 0b000000,
+		"le":      0b000001, // RFC 8622
+		"cs1":     0b001000,
+		"af11":    0b001010,
+		"af12":    0b001100,
+		"af13":    0b001110,
+		"cs2":     0b010000,
+		"af21":    0b010010,
+		"af22":    0b010100,
+		"af23":    0b010110,
+		"cs3":     0b011000,
+		"af31":    0b011010,
+		"af32":    0b011100,
+		"af33":    0b011110,
+		"cs4":     0b100000,
+		"af41":    0b100010,
+		"af42":    0b100100,
+		"af43":    0b100110,
+		"cs5":     0b101000,
+		"va":      0b101100, // RFC 5865
+		"ef":      0b101110,
+		"cs6":     0b110000,
+		"cs7":     0b111000,
+	}
+	DscpAliasMap = map[string]uint64{
+		"cs0":        0b000000,
+		"besteffort": 0b000000,
+	}
+	DscpClassMagicMap = map[string]uint64{ // af class, i.e. first 3 bits of dscp
+		"af1x": 1,
+		"af2x": 2,
+		"af3x": 3,
+		"af4x": 4,
+	}
+	FlowTypeMagicMap = map[string]uint64{ // explicit
+		"sflow": 1,
+		"nfv5":  2,
+		"nfv9":  3,
+		"ipfix": 4,
+		"ebpf":  5,
 	}
 	RpkiMagicMap = map[string]uint64{"unknown": 0,
 		"valid":    1,
@@ -112,7 +167,99 @@ var (
 	}
 )
 
+// magicPattern builds a lexer pattern matching any of the magic strings in
+// the given maps. Longer strings are tried first, as some are prefixes of
+// others when ignoring dashes, i.e. 'ipv6' and 'ipv6-icmp'.
+func magicPattern(maps ...map[string]uint64) string {
+	var magics []string
+	for _, m := range maps {
+		for magic := range m {
+			magics = append(magics, regexp.QuoteMeta(magic))
+		}
+	}
+	sort.Slice(magics, func(i, j int) bool {
+		if len(magics[i]) != len(magics[j]) {
+			return len(magics[i]) > len(magics[j])
+		}
+		return magics[i] < magics[j]
+	})
+	return `\b(` + strings.Join(magics, "|") + `)\b`
+}
+
 func Parse(input string) (*Expression, error) {
 	expr, err := parser.ParseString("parser", input)
-	return expr, err
+	if err != nil {
+		return expr, err
+	}
+	return expr, validate(expr)
+}
+
+// validate checks constraints which are not expressed by the grammar.
+func validate(expr *Expression) error {
+	return Visit(expr, func(n Node, next func() error) error {
+		switch node := n.(type) {
+		case *Comparison:
+			left, err := sumType(node.Left)
+			if err != nil {
+				return err
+			}
+			right, err := sumType(node.Right)
+			if err != nil {
+				return err
+			}
+			if left != right {
+				return fmt.Errorf("can not compare %s to %s", left, right)
+			}
+			if left != NumberField && *node.Operator != "==" && *node.Operator != "!=" {
+				return fmt.Errorf("can not compare %s fields using %q", left, *node.Operator)
+			}
+		case *HasMatch:
+			if !PresenceFields[node.Name()] {
+				return fmt.Errorf("unknown field %q", node.Name())
+			}
+		case *CustomerMatch:
+			if err := resolveCustomers(node); err != nil {
+				return err
+			}
+		case *IcmpMatch:
+			messages := node.Messages
+			if node.Message != nil {
+				messages = append(messages, node.Message)
+			}
+			for _, message := range messages {
+				if err := resolveIcmpMessage(string(*node.Version), message); err != nil {
+					return err
+				}
+			}
+			if node.TypeName != nil {
+				if err := resolveIcmpMessage(string(*node.Version), node.TypeName); err != nil {
+					return err
+				}
+				if node.TypeName.Code != nil {
+					return fmt.Errorf("%s type takes a type name, not %q", *node.Version, *node.TypeName.Name)
+				}
+			}
+		case *PrefixMatch:
+			if int(*node.Mask) > node.Bits() {
+				return fmt.Errorf("bad prefix length %d", *node.Mask)
+			}
+			if node.UpTo != nil && (*node.UpTo < *node.Mask || int(*node.UpTo) > node.Bits()) {
+				return fmt.Errorf("bad upto length %d for prefix length %d", *node.UpTo, *node.Mask)
+			}
+		case *TimeMatch:
+			if node.Within != nil && node.Location != nil {
+				return fmt.Errorf("within does not take a time zone")
+			}
+		case *DirectionalMatchGroup:
+			if node.Direction == nil {
+				break
+			}
+			if *node.Direction == "ingress" || *node.Direction == "egress" {
+				if node.Interface == nil && node.Vrf == nil {
+					return fmt.Errorf("direction %s applies to iface and vrf matches only", *node.Direction)
+				}
+			}
+		}
+		return next()
+	})
 }
@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -22,6 +24,12 @@ func TestAccept(t *testing.T) {
 		`src address 2001:db8::1`,
 		`address 2001:db8:efef:affe::1`,
 		`dst address 2001:db8:efef:affe::1`,
+		`address 10:20:30:40:50:60::1`,
+		`address 12:34:56:78:9a:bc::1`,
+		`address 10:20::1`,
+		`address 12:30::/32`,
+		`address 10:20:30::4`,
+		`address 20:10:0:0:0:0:0:1`,
 		`address 1.0.0.1/0`,
 		`src address 10.0.0.1/10`,
 		`dst address 255.255.255.255/255`,
@@ -39,6 +47,11 @@ func TestAccept(t *testing.T) {
 		`port 7-1`,
 		`port 0xff2`,
 		`src port 0b1-0x23`,
+		`port ssh`,
+		`dst port {https, dns}`,
+		`port {ms-wbt-server, ms-sql-s, rfb}`,
+		`src port {22, 8000-8080, >60000}`,
+		`port ftp-data`,
 		// interface
 		`src iface 1`,
 		`src interface 4`,
@@ -46,6 +59,9 @@ func TestAccept(t *testing.T) {
 		`dst iface 42`,
 		`dst iface 42`,
 		`dst iface name 'Te'`,
+		`iface 5 on router 10.0.0.1`,
+		`src iface 10.0.0.1:5`,
+		`iface {1, 10.0.0.1:2, 3 on router 2001:db8::1}`,
 		`src iface desc 'hello'`,
 		`src iface speed 123`,
 		`dst iface speed >123`,
@@ -53,14 +69,181 @@ func TestAccept(t *testing.T) {
 		// proto
 		`not proto 1`,
 		`proto 4`,
+		`proto gre`,
+		`proto ospf`,
+		`proto ipv6-icmp`,
+		`proto rsvp-e2e-ignore`,
 		// etype
 		`etype 1`,
 		`etype 0x800`,
+		`etype ipv6`,
+		// dscp
+		`dscp ef`,
+		`dscp af4x`,
+		`dscp cs5-cs7`,
+		`dscp 10-20`,
+		`dscp besteffort`,
+		// ecn
+		`ecn capable`,
+		`ecn notect`,
+		// status
+		`status dropped`,
+		`status class consumed`,
+		`status reason wred`,
+		`status policerdrop`,
+		`status {badttl, fragdf, 128}`,
+		`status reason adjacency-hardware`,
+		// tcpflags
+		`tcpflags finack`,
+		`tcpflags 0x12`,
+		`tcpflags any {syn, rst}`,
+		`tcpflags all {syn, ack}`,
+		`tcpflags none {ack, fin}`,
+		`tcpflags only syn`,
+		`tcpflags any 0x12`,
+		// icmp
+		`icmp type 3`,
+		`icmp code {0, 3-5}`,
+		`icmp echo-request`,
+		`icmp dest-unreach port-unreach`,
+		`icmp {echo-request, echo-reply}`,
+		`icmpv6 packet-too-big`,
+		`icmpv6 neighbor-solicit`,
+		`icmpv6 type >127`,
+		`icmp type echo-request`,
+		`icmpv6 type packet-too-big`,
 		// composite
 		`(proto 6 and port 456) or src iface 0 and address 1.1.1.1`,
 		// cid
 		`cid 1`,
 		`src cid 1-2`,
+		// mac
+		`src mac 00:1b:21:3a:4b:5c`,
+		`dst mac AC-DE-48-00-11-22`,
+		`mac 001b.213a.4b5c`,
+		`mac ef:00:00:00:00:01`,
+		`mac 12:34:56:78:9a:bc`,
+		`mac 0A:1b:21:3a:4b:5c`,
+		`mac a1:b2:c3:d4:e5:f6`,
+		`src mac 00:1b:21:*`,
+		`mac 01-*`,
+		`dst mac broadcast`,
+		`mac multicast`,
+		// vlan
+		`vlan 100`,
+		`src vlan 100-199`,
+		`address 10.0.0.1 and mac 00:1b:21:3a:4b:5c`,
+		// mpls
+		`mpls present`,
+		`mpls depth >2`,
+		`mpls label 16000-16999`,
+		`mpls top label 24001`,
+		`mpls bottom ttl <2`,
+		`proto mpls-in-ip`,
+		// encap
+		`encap present`,
+		`encap proto gre`,
+		`not encap etype ipv6`,
+		`proto encap`,
+		// ip header
+		`ttl <5`,
+		`flowlabel 0x12345`,
+		`fragment-id 1-100`,
+		`fragment-offset >0`,
+		`fragment`,
+		`first-fragment or non-first-fragment`,
+		`not fragment and mpls top ttl 1`,
+		// export metadata
+		`router 10.0.0.0/8`,
+		`router {10.0.0.1, 2001:db8::1}`,
+		`nexthop {10.0.0.0/8, 192.168.0.0/16}`,
+		`type sflow`,
+		`type {ipfix, nfv9}`,
+		`type 4`,
+		`age >300`,
+		`age >5m`,
+		`age 1h-1d`,
+		`age <1h30m`,
+		`sequence 1000-2000`,
+		// aspath
+		`aspath ~ "^553 (174|3356) .* 6830$"`,
+		`aspath ~ '_553_'`,
+		`aspath ~ "^(553 ){2,}"`,
+		`aspath length >5`,
+		`aspath origin 6830`,
+		`aspath first 553`,
+		`aspath prepended`,
+		`aspath contains-private`,
+		// local, remote, ingress, egress
+		`remote asn 6830`,
+		`local address 129.143.0.0/16`,
+		`remote port 443`,
+		`ingress iface 5`,
+		`egress vrf 2`,
+		`not ingress interface name 'Hu'`,
+		// both, either
+		`both address 10.0.0.0/8`,
+		`both asn 553`,
+		`either port {http, https}`,
+		// comparisons
+		`src asn == dst asn`,
+		`src port < dst port`,
+		`src cid != dst cid`,
+		`InIf == OutIf`,
+		`bytes >= packets`,
+		`router != nexthop`,
+		`src mac == dst mac`,
+		`not src address == dst address`,
+		`src port <1000`,
+		`src asn 553 and src asn != dst asn`,
+		// arithmetic
+		`bytes / packets > 1400`,
+		`bytes * samplingrate > 1G`,
+		`(timeflowend - timeflowstart) > 300`,
+		`((bytes + packets)) * 2 > 5`,
+		`(bytes / packets > 1400 or proto tcp)`,
+		`bytes - 1 == packets`,
+		`bytes >1G`,
+		`bytes 1Gi-2Gi`,
+		`packets <10k`,
+		// scaled
+		`bytes scaled >1G`,
+		`packets scaled 100-200`,
+		`bps scaled >1G`,
+		`not pps scaled <1000`,
+		// time
+		`time 08:00-18:00`,
+		`not time 22:00-06:00 in "Europe/Berlin"`,
+		`weekday mon-fri`,
+		`weekday sat-mon`,
+		`start after 2026-10-01T00:00Z`,
+		`end before 2026-10-01T12:00:00+02:00`,
+		`start after 2026-10-01 in 'Europe/Berlin'`,
+		`received within 5m`,
+		`received within 1h30m`,
+		`address 2001:db8::1 and time 00:00-24:00`,
+		// has
+		`has country`,
+		`exists src iface name`,
+		`has dst interface speed`,
+		`not has rpki`,
+		`has src cid and not country de`,
+		// countries
+		`country DE`,
+		`src country de`,
+		`remote country {de, at, ch}`,
+		`country eu`,
+		`country st`,
+		`country va`,
+		`dst continent north-america`,
+		`not dst continent {asia, oceania}`,
+		`src rpki invalid`,
+		`either rpki notfound or rpki valid`,
+		`has dst rpki`,
+		`src prefix 10.0.0.0/8 exact`,
+		`dst prefix 10.0.0.0/16 orlonger`,
+		`prefix 2001:db8::/32 longer`,
+		`prefix 10.0.0.0/16 upto /24 and not dst prefix 10.0.0.0/16`,
 	}
 
 	for _, test := range tests {
@@ -86,9 +269,107 @@ func TestReject(t *testing.T) {
 		`src address 10.0.0.1//`,
 		`dst address 255.255.255.257/255`,
 		`not not port 4`,
+		`port nosuchservice`,
+		`port {}`,
+		`port {22 80}`,
+		`etype tcp`,
+		`dscp 10-99`,
+		`dscp af5x`,
+		`dscp af4x-af4x`,
+		`status reason dropped`,
+		`status class wred`,
+		`status 256`,
+		`tcpflags some syn`,
+		`tcpflags any {syn, 2}`,
+		`icmp`,
+		`icmp echo`,
+		`icmp packet-too-big`,
+		`icmpv6 source-quench`,
+		`icmp echo-request port-unreach`,
+		`icmp {echo-request, mld-query}`,
+		`icmp type port-unreach`,
+		`icmp type dest-unreach port-unreach`,
+		`mac 00:1b:21:3a:4b`,
+		`mac 00:1b-21:3a:4b:5c`,
+		`mac 00:1b:21`,
+		`mac 12:34:56:78:9a:bc::1`,
+		`mac 10.0.0.1`,
+		`mac unicast`,
+		`vlan broadcast`,
+		`mpls`,
+		`mpls top`,
+		`mpls top depth 2`,
+		`mpls label present`,
+		`encap`,
+		`port 5m`,
+		`ttl`,
+		`fragment 1`,
+		`fragment-id`,
+		`router {}`,
+		`router 10.0.0.1/`,
+		`type netflow`,
+		`type {1, 2}`,
+		`aspath ~ "553[0-9]"`,
+		`aspath ~ "(553"`,
+		`aspath ~ 553`,
+		`aspath origin`,
+		`ingress address 10.0.0.1`,
+		`egress port 22`,
+		`remote`,
+		`both`,
+		`src both asn 553`,
 		`dst iface id 'bla'`,
 		`dst iface name 4`,
+		`iface 10.0.0.1`,
+		`iface 2001:db8::1:5`,
+		`iface 5 on router`,
+		`iface {}`,
 		`src iface desc "lksj'`,
+		`src address == dst asn`,
+		`src mac < dst mac`,
+		`router > nexthop`,
+		`src bytes == dst bytes`,
+		`foo == bar`,
+		`src asn ==`,
+		`src address + 1 > 5`,
+		`src mac * 2 == 4`,
+		`foo + 1 > 5`,
+		`bytes / > 5`,
+		`(bytes - packets > 5`,
+		`bytes >20000000T`,
+		`bytes >1X`,
+		`bytes >1G scaled`,
+		`scaled bytes >1G`,
+		`duration scaled >5`,
+		`time 08:00`,
+		`time 25:00-26:00`,
+		`time 10:20::1-18:00`,
+		`time 18:00:00:00-20:00`,
+		`time 8:00-18:00`,
+		`weekday mon-foo`,
+		`start after 2026-13-01`,
+		`received within 5m in "Europe/Berlin"`,
+		`time 08:00-18:00 in "Mars/Olympus Mons"`,
+		`start within 5`,
+		`received time`,
+		`has`,
+		`has foo`,
+		`has bytes`,
+		`has iface name`,
+		`has src country name`,
+		`country xx`,
+		`country e`,
+		`country {de, xx}`,
+		`country {}`,
+		`continent atlantis`,
+		`src rpki`,
+		`rpki src invalid`,
+		`prefix 10.0.0.0`,
+		`prefix 10.0.0.0/33`,
+		`prefix 2001:db8::/129 longer`,
+		`prefix 10.0.0.0/16 upto /8`,
+		`prefix 10.0.0.0/16 upto /33`,
+		`prefix 10.0.0.0/16 upto 24`,
 	}
 
 	for _, test := range tests {
@@ -98,3 +379,117 @@ func TestReject(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadServices(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "services")
+	err := os.WriteFile(filename, []byte(`# comment
+gopher		70/tcp				# Internet Gopher
+http		80/tcp		www		# WorldWideWeb HTTP
+zabbix-agent	10050/tcp	zabbix
+zabbix-agent	10050/udp
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadServices(filename); err != nil {
+		t.Fatal(err)
+	}
+	for name, port := range map[string]uint64{"gopher": 70, "zabbix-agent": 10050} {
+		if ServiceMagicMap[name] != port {
+			t.Errorf("Service `%s` was not loaded as port %d.\n", name, port)
+		}
+	}
+	if ServiceAliasMap["zabbix"] != 10050 {
+		t.Errorf("Alias `zabbix` was not loaded.\n")
+	}
+	if ServiceMagicMap["www"] != 0 || ServiceMagicMap["http"] != 80 {
+		t.Errorf("Existing service names were modified.\n")
+	}
+	if _, err := Parse(`port {gopher, zabbix}`); err != nil {
+		t.Errorf("Loaded services could not be parsed:\n%s\n", err)
+	}
+}
+
+func TestLoadServicesErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "services")
+	err := os.WriteFile(filename, []byte(`krb5_prop	754/tcp		tell
+ptp-event	319/udp
+finger		79/tcp
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadServices(filename); err == nil {
+		t.Errorf("Service names which can not be parsed were loaded without error.\n")
+	}
+	if ServiceMagicMap["finger"] != 79 || ServiceAliasMap["tell"] != 754 {
+		t.Errorf("Valid service names were not loaded alongside bad ones.\n")
+	}
+	if _, ok := ServiceMagicMap["krb5_prop"]; ok {
+		t.Errorf("Service `krb5_prop` was loaded although it can not be parsed.\n")
+	}
+}
+
+func TestLoadCustomers(t *testing.T) {
+	t.Cleanup(func() { Customers = nil })
+	if _, err := Parse(`customer "Uni Stuttgart"`); err == nil {
+		t.Errorf("Customer match parsed without customer directory.\n")
+	}
+
+	files := map[string]string{
+		"customers.csv": `cid,name
+# comment
+1000,Uni Stuttgart
+1001, "Uni Stuttgart"
+2000,HS-Esslingen
+2001,HS-Aalen
+`,
+		"customers.yaml": `- cid: 1000
+  name: Uni Stuttgart
+- cid: 1001
+  name: Uni Stuttgart
+- cid: 2000
+  name: HS-Esslingen
+- cid: 2001
+  name: HS-Aalen
+`,
+	}
+	for name, content := range files {
+		filename := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadCustomers(filename); err != nil {
+			t.Fatalf("Failed to load %s:\n%s\n", name, err)
+		}
+		tests := map[string][]uint32{
+			`customer "Uni Stuttgart"`: {1000, 1001},
+			`src customer ~ "^HS-"`:    {2000, 2001},
+			`customer ~ "Aalen|Uni"`:   {1000, 1001, 2001},
+		}
+		for test, expected := range tests {
+			expr, err := Parse(test)
+			if err != nil {
+				t.Errorf("Input `%s` failed with %s:\n%s\n", test, name, err)
+				continue
+			}
+			cids := expr.Left.DirectionalMatch.Customer.Cids
+			if fmt.Sprint(cids) != fmt.Sprint(expected) {
+				t.Errorf("Input `%s` resolved to %v with %s, expected %v.\n", test, cids, name, expected)
+			}
+		}
+		for _, test := range []string{`customer "Uni Ulm"`, `customer ~ "^FH-"`, `customer ~ "("`, `customer uni`} {
+			if _, err := Parse(test); err == nil {
+				t.Errorf("Input `%s` did not fail with %s.\n", test, name)
+			}
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "broken.csv")
+	if err := os.WriteFile(filename, []byte("1000,Uni Stuttgart\nxyz,Uni Ulm\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadCustomers(filename); err == nil {
+		t.Errorf("Bad cid in %s did not fail.\n", filename)
+	}
+}
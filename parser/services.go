@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+var (
+	// Built-in service names for use with port matches, as registered with
+	// IANA. Transport protocols are not differentiated, a name always refers
+	// to its port number.
+	ServiceMagicMap = map[string]uint64{ // explicit
+		"ftp-data":      20,
+		"ftp":           21,
+		"ssh":           22,
+		"telnet":        23,
+		"smtp":          25,
+		"nicname":       43,
+		"tacacs":        49,
+		"domain":        53,
+		"bootps":        67,
+		"bootpc":        68,
+		"tftp":          69,
+		"http":          80,
+		"kerberos":      88,
+		"pop3":          110,
+		"sunrpc":        111,
+		"auth":          113,
+		"ntp":           123,
+		"netbios-ns":    137,
+		"netbios-dgm":   138,
+		"netbios-ssn":   139,
+		"imap":          143,
+		"snmp":          161,
+		"snmptrap":      162,
+		"bgp":           179,
+		"ldap":          389,
+		"https":         443,
+		"microsoft-ds":  445,
+		"submissions":   465,
+		"isakmp":        500,
+		"syslog":        514,
+		"submission":    587,
+		"ldaps":         636,
+		"rsync":         873,
+		"imaps":         993,
+		"pop3s":         995,
+		"openvpn":       1194,
+		"ms-sql-s":      1433,
+		"l2tp":          1701,
+		"radius":        1812,
+		"radius-acct":   1813,
+		"nfs":           2049,
+		"mysql":         3306,
+		"ms-wbt-server": 3389,
+		"ipsec-nat-t":   4500,
+		"sip":           5060,
+		"sip-tls":       5061,
+		"postgresql":    5432,
+		"rfb":           5900,
+		"x11":           6000,
+		"http-alt":      8080,
+	}
+	// Alternative names for services, accepted when parsing but never
+	// printed. These are common names not in the IANA registry.
+	ServiceAliasMap = map[string]uint64{
+		"whois": 43,
+		"dns":   53,
+		"www":   80,
+		"ident": 113,
+		"smb":   445,
+		"mssql": 1433,
+		"rdp":   3389,
+		"sips":  5061,
+		"vnc":   5900,
+	}
+)
+
+// LoadServices extends the service names known to the parser from a file in
+// the format of /etc/services. Names for ports which already have a name are
+// added as aliases. Names which can not be used in port matches, i.e.
+// `krb5_prop`, are rejected with an error after loading all others. This is
+// not safe to call while other goroutines parse.
+func LoadServices(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	names := reverseMap(ServiceMagicMap)
+	var errs []error
+	scanner := bufio.NewScanner(file)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		} else if len(fields) < 2 {
+			return fmt.Errorf("%s:%d: missing port", filename, lineno)
+		}
+		portstr, _, _ := strings.Cut(fields[1], "/")
+		port, err := strconv.ParseUint(portstr, 10, 16)
+		if err != nil {
+			return fmt.Errorf("%s:%d: bad port %q", filename, lineno, fields[1])
+		}
+		for i, name := range fields {
+			if i == 1 {
+				continue
+			}
+			if _, ok := ServiceMagicMap[name]; ok {
+				continue
+			}
+			if !isServiceName(name) {
+				errs = append(errs, fmt.Errorf("%s:%d: bad service name %q", filename, lineno, name))
+				continue
+			}
+			if _, ok := names[port]; ok || i > 1 {
+				ServiceAliasMap[name] = port
+			} else {
+				ServiceMagicMap[name] = port
+				names[port] = name
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// isServiceName returns whether a name lexes as a single token accepted by
+// port matches.
+func isServiceName(name string) bool {
+	lex, err := bpfLexer.LexString("", name)
+	if err != nil {
+		return false
+	}
+	tokens, err := lexer.ConsumeAll(lex)
+	if err != nil || len(tokens) != 2 { // name and EOF
+		return false
+	}
+	symbols := bpfLexer.Symbols()
+	return tokens[0].Type == symbols["Identifier"] || tokens[0].Type == symbols["ProtoMagic"]
+}
+
+// reverseMap turns a magic map into a lookup from value to magic string.
+func reverseMap(m map[string]uint64) map[uint64]string {
+	n := make(map[uint64]string)
+	for k, v := range m {
+		n[v] = k
+	}
+	return n
+}
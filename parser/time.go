@@ -0,0 +1,190 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeOfDay is a wall clock time, i.e. `08:00` or `23:59:59`, stored as
+// seconds since midnight. `24:00` refers to the end of the day.
+type TimeOfDay uint64
+
+func (o TimeOfDay) children() []Node { return nil }
+
+const timeOfDayPattern = `([01]\d|2[0-4]):[0-5]\d(:[0-5]\d)?`
+
+var timeOfDayRegexp = regexp.MustCompile(`^` + timeOfDayPattern + `$`)
+
+func (o *TimeOfDay) Capture(values []string) error {
+	if !timeOfDayRegexp.MatchString(values[0]) {
+		return fmt.Errorf("bad time of day %q", values[0])
+	}
+	parts := strings.Split(values[0], ":")
+	var seconds uint64
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return err
+		}
+		seconds += n * []uint64{3600, 60, 1}[i]
+	}
+	if seconds > 24*3600 {
+		return fmt.Errorf("bad time of day %q", values[0])
+	}
+	*o = TimeOfDay(seconds)
+	return nil
+}
+
+func (o TimeOfDay) String() string {
+	if o%60 != 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", o/3600, o/60%60, o%60)
+	}
+	return fmt.Sprintf("%02d:%02d", o/3600, o/60%60)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+	"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// WeekdayRange is a single weekday or an inclusive range of weekdays, i.e.
+// `sat` or `mon-fri`. Ranges wrap around the end of the week, i.e. `fri-mon`.
+type WeekdayRange struct {
+	From time.Weekday
+	To   time.Weekday
+}
+
+func (o WeekdayRange) children() []Node { return nil }
+
+func (o *WeekdayRange) Capture(values []string) error {
+	from, to, isRange := strings.Cut(values[0], "-")
+	if !isRange {
+		to = from
+	}
+	var ok bool
+	if o.From, ok = weekdays[from]; !ok {
+		return fmt.Errorf("bad weekday %q", from)
+	}
+	if o.To, ok = weekdays[to]; !ok {
+		return fmt.Errorf("bad weekday %q", to)
+	}
+	return nil
+}
+
+// Contains returns whether a weekday is part of the range.
+func (o WeekdayRange) Contains(day time.Weekday) bool {
+	if o.From <= o.To {
+		return o.From <= day && day <= o.To
+	}
+	return day >= o.From || day <= o.To
+}
+
+func (o WeekdayRange) String() string {
+	from := strings.ToLower(o.From.String()[:3])
+	if o.From == o.To {
+		return from
+	}
+	return from + "-" + strings.ToLower(o.To.String()[:3])
+}
+
+// Timestamp is a point in time in RFC 3339 notation, with optional seconds,
+// time and offset, i.e. `2026-10-01T00:00Z` or `2026-10-01`. Timestamps
+// without offset are resolved in the time zone of their match.
+type Timestamp struct {
+	Expr  string
+	Time  time.Time // in UTC if unzoned
+	Zoned bool
+}
+
+func (o Timestamp) children() []Node { return nil }
+
+func (o *Timestamp) Capture(values []string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, values[0]); err == nil {
+			*o = Timestamp{Expr: values[0], Time: t, Zoned: true}
+			return nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, values[0]); err == nil {
+			*o = Timestamp{Expr: values[0], Time: t}
+			return nil
+		}
+	}
+	return fmt.Errorf("bad timestamp %q", values[0])
+}
+
+// In returns the timestamp, using the given location if it has no offset.
+func (o Timestamp) In(loc *time.Location) time.Time {
+	if o.Zoned {
+		return o.Time
+	}
+	t := o.Time
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+// Duration is a length of time made up of numbers with units `s`, `m`, `h`,
+// `d` or `w`, i.e. `5m` or `1h30m`.
+type Duration time.Duration
+
+func (o Duration) children() []Node { return nil }
+
+var durationUnits = map[byte]time.Duration{
+	's': time.Second, 'm': time.Minute, 'h': time.Hour,
+	'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour,
+}
+
+func (o *Duration) Capture(values []string) error {
+	var duration time.Duration
+	rest := values[0]
+	for rest != "" {
+		i := strings.IndexAny(rest, "smhdw")
+		if i < 0 {
+			return fmt.Errorf("bad duration %q", values[0])
+		}
+		n, err := strconv.ParseUint(rest[:i], 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad duration %q", values[0])
+		}
+		duration += time.Duration(n) * durationUnits[rest[i]]
+		rest = rest[i+1:]
+	}
+	*o = Duration(duration)
+	return nil
+}
+
+func (o Duration) String() string {
+	var b strings.Builder
+	rest := time.Duration(o)
+	for _, unit := range []byte("wdhms") {
+		if n := rest / durationUnits[unit]; n > 0 {
+			fmt.Fprintf(&b, "%d%c", n, unit)
+			rest -= n * durationUnits[unit]
+		}
+	}
+	if b.Len() == 0 {
+		return "0s"
+	}
+	return b.String()
+}
+
+// Location is a time zone from the IANA database, i.e. `"Europe/Berlin"`.
+type Location struct {
+	Name     string
+	Location *time.Location
+}
+
+func (o Location) children() []Node { return nil }
+
+func (o *Location) Capture(values []string) error {
+	loc, err := time.LoadLocation(values[0])
+	if err != nil {
+		return fmt.Errorf("bad time zone %q: %w", values[0], err)
+	}
+	*o = Location{Name: values[0], Location: loc}
+	return nil
+}
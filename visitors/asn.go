@@ -0,0 +1,140 @@
+package visitors
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/banviktor/asnlookup/pkg/database"
+	"github.com/banviktor/go-mrt"
+)
+
+// ASNResolver resolves addresses to the AS originating their most specific
+// prefix. It is consulted by asn matches on flows which have not been
+// exported with the respective AS. Zero means the address could not be
+// resolved. AS path matches are not affected, as an origin is no path.
+type ASNResolver interface {
+	OriginAsn(address net.IP) uint32
+}
+
+// MRTASNResolver is an ASNResolver backed by a RIB dump in MRT TABLE_DUMP_V2
+// format, optionally compressed using gzip or bzip2 as indicated by a `.gz`
+// or `.bz2` extension. The dump can be reloaded at runtime. It is safe for
+// concurrent use.
+type MRTASNResolver struct {
+	path string
+
+	mutex sync.RWMutex
+	db    database.Database
+}
+
+// LoadMRTASNResolver reads a RIB dump from the given path.
+func LoadMRTASNResolver(path string) (*MRTASNResolver, error) {
+	resolver := &MRTASNResolver{path: path}
+	if err := resolver.Reload(); err != nil {
+		return nil, err
+	}
+	return resolver, nil
+}
+
+// Reload rereads the RIB dump, i.e. after it has been replaced by a newer
+// one. Lookups use the previous table until the new one is complete, which
+// is kept if reading fails.
+func (r *MRTASNResolver) Reload() error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var input io.Reader = file
+	switch filepath.Ext(r.path) {
+	case ".gz":
+		if input, err = gzip.NewReader(file); err != nil {
+			return fmt.Errorf("bad RIB dump %s: %w", r.path, err)
+		}
+	case ".bz2":
+		input = bzip2.NewReader(file)
+	}
+
+	builder := database.NewBuilder()
+	reader := mrt.NewReader(input)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("bad RIB dump %s: %w", r.path, err)
+		}
+		rib, ok := record.(*mrt.TableDumpV2RIB)
+		if !ok {
+			continue
+		}
+		if ones, _ := rib.Prefix.Mask.Size(); ones == 0 {
+			continue // default routes do not tell anything
+		}
+		if origin := ribOrigin(rib); origin != 0 {
+			if err := builder.InsertMapping(rib.Prefix, origin); err != nil {
+				return fmt.Errorf("bad RIB dump %s: %w", r.path, err)
+			}
+		}
+	}
+	db, err := builder.Build()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	r.db = db
+	r.mutex.Unlock()
+	return nil
+}
+
+// ribOrigin returns the origin AS of the first RIB entry with an AS path,
+// which is the last AS of its last AS_SEQUENCE segment. Paths ending in an
+// AS_SET have no single origin and are skipped.
+func ribOrigin(rib *mrt.TableDumpV2RIB) uint32 {
+	for _, entry := range rib.RIBEntries {
+		for _, attr := range entry.BGPAttributes {
+			path, ok := attr.Value.(mrt.BGPPathAttributeASPath)
+			if !ok || len(path) == 0 {
+				continue
+			}
+			segment := path[len(path)-1]
+			if segment.Type != mrt.BGPASPathSegmentTypeASSequence || len(segment.Value) == 0 {
+				return 0
+			}
+			switch as := segment.Value[len(segment.Value)-1]; len(as) {
+			case 2:
+				return uint32(binary.BigEndian.Uint16(as))
+			case 4:
+				return binary.BigEndian.Uint32(as)
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// OriginAsn returns the origin AS of the most specific prefix containing the
+// address, or zero if there is none.
+func (r *MRTASNResolver) OriginAsn(address net.IP) uint32 {
+	address = address.To16()
+	if address == nil {
+		return 0
+	}
+	r.mutex.RLock()
+	db := r.db
+	r.mutex.RUnlock()
+	as, err := db.Lookup(address)
+	if err != nil {
+		return 0
+	}
+	return as.Number
+}
@@ -0,0 +1,186 @@
+package visitors
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BelWue/flowfilter/parser"
+	"github.com/BelWue/flowpipeline/pb"
+)
+
+// mrtRoute is a RIB entry of a test dump. A set is appended to the path as
+// AS_SET segment if given.
+type mrtRoute struct {
+	prefix string
+	path   []uint32
+	set    []uint32
+}
+
+// writeMRT writes a MRT TABLE_DUMP_V2 RIB dump with a single peer, gzip
+// compressed if the name says so.
+func writeMRT(t *testing.T, name string, routes []mrtRoute) string {
+	var dump bytes.Buffer
+	record := func(subtype uint16, body []byte) {
+		header := make([]byte, 12)
+		binary.BigEndian.PutUint32(header[0:], 1760000000)
+		binary.BigEndian.PutUint16(header[4:], 13) // TABLE_DUMP_V2
+		binary.BigEndian.PutUint16(header[6:], subtype)
+		binary.BigEndian.PutUint32(header[8:], uint32(len(body)))
+		dump.Write(header)
+		dump.Write(body)
+	}
+	segment := func(kind byte, ases []uint32) []byte {
+		b := []byte{kind, byte(len(ases))}
+		for _, as := range ases {
+			b = binary.BigEndian.AppendUint32(b, as)
+		}
+		return b
+	}
+
+	// collector 192.0.2.1 without view name, with peer 192.0.2.2 in AS 65000
+	record(1, []byte{192, 0, 2, 1, 0, 0, 0, 1, 0x2, 192, 0, 2, 2, 192, 0, 2, 2, 0, 0, 0xfd, 0xe8})
+	for i, route := range routes {
+		_, prefix, err := net.ParseCIDR(route.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, size := prefix.Mask.Size()
+		subtype, address := uint16(4), prefix.IP.To16()
+		if size == 32 {
+			subtype, address = 2, prefix.IP.To4()
+		}
+		path := segment(2, route.path)
+		if route.set != nil {
+			path = append(path, segment(1, route.set)...)
+		}
+		attrs := append([]byte{0x40, 1, 1, 0, 0x40, 2, byte(len(path))}, path...)
+
+		body := binary.BigEndian.AppendUint32(nil, uint32(i))
+		body = append(body, byte(ones))
+		body = append(body, address[:(ones+7)/8]...)
+		body = binary.BigEndian.AppendUint16(body, 1)
+		body = binary.BigEndian.AppendUint16(body, 0)
+		body = binary.BigEndian.AppendUint32(body, 1760000000)
+		body = binary.BigEndian.AppendUint16(body, uint16(len(attrs)))
+		body = append(body, attrs...)
+		record(subtype, body)
+	}
+
+	data := dump.Bytes()
+	if filepath.Ext(name) == ".gz" {
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		w.Write(data)
+		w.Close()
+		data = compressed.Bytes()
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var testRoutes = []mrtRoute{
+	{prefix: "0.0.0.0/0", path: []uint32{65000}},
+	{prefix: "10.0.0.0/8", path: []uint32{65000, 64512}},
+	{prefix: "10.1.0.0/16", path: []uint32{65000, 553, 553}},
+	{prefix: "192.0.2.0/24", path: []uint32{65000}, set: []uint32{64513, 64514}},
+	{prefix: "2001:db8::/32", path: []uint32{65000, 4200000000}},
+}
+
+func TestMRTASNResolver(t *testing.T) {
+	for _, name := range []string{"rib", "rib.gz"} {
+		resolver, err := LoadMRTASNResolver(writeMRT(t, name, testRoutes))
+		if err != nil {
+			t.Fatalf("Failed to load %s: %s\n", name, err)
+		}
+		tests := map[string]uint32{
+			"10.0.0.1":    64512,
+			"10.1.2.3":    553, // most specific
+			"192.0.2.1":   0,   // originated by a set
+			"203.0.113.1": 0,   // default route only
+			"2001:db8::1": 4200000000,
+		}
+		for address, expected := range tests {
+			if as := resolver.OriginAsn(net.ParseIP(address)); as != expected {
+				t.Errorf("Address %s resolved to AS%d from %s, expected AS%d.\n", address, as, name, expected)
+			}
+		}
+	}
+}
+
+func TestMRTASNResolverReload(t *testing.T) {
+	path := writeMRT(t, "rib", testRoutes)
+	resolver, err := LoadMRTASNResolver(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := os.ReadFile(writeMRT(t, "rib", []mrtRoute{{prefix: "10.0.0.0/8", path: []uint32{6830}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, updated, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolver.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if as := resolver.OriginAsn(net.ParseIP("10.1.2.3")); as != 6830 {
+		t.Errorf("Address 10.1.2.3 resolved to AS%d after reload, expected AS6830.\n", as)
+	}
+
+	// broken dumps keep the previous table
+	if err := os.WriteFile(path, []byte("garbage, not MRT"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolver.Reload(); err == nil {
+		t.Errorf("Reloading a broken dump did not fail.\n")
+	}
+	if as := resolver.OriginAsn(net.ParseIP("10.1.2.3")); as != 6830 {
+		t.Errorf("Address 10.1.2.3 resolved to AS%d after failed reload, expected AS6830.\n", as)
+	}
+}
+
+func TestASNResolver(t *testing.T) {
+	resolver, err := LoadMRTASNResolver(writeMRT(t, "rib", testRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowmsg := &pb.EnrichedFlow{
+		SrcAddr: net.ParseIP("10.1.2.3").To4(),
+		DstAddr: net.ParseIP("2001:db8::1"),
+		DstAs:   6830, // exported ASes take precedence
+	}
+	tests := map[string]bool{
+		`src asn 553`:         true,
+		`asn 553`:             true,
+		`dst asn 4200000000`:  false,
+		`dst asn 6830`:        true,
+		`src asn 64512-64520`: false,
+		`has src asn`:         true,
+		`not src asn 0`:       true,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+			continue
+		}
+		filter := &Filter{ASNResolver: resolver}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+}
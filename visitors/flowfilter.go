@@ -1,17 +1,53 @@
 package visitors
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"math/bits"
 	"net"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/BelWue/flowfilter/parser"
 	"github.com/BelWue/flowpipeline/pb"
 )
 
 type Filter struct {
-	flowmsg     *pb.EnrichedFlow
-	__direction string // this is super hacky
+	// By default, tcpflags matches never match flows which are not TCP.
+	// If set, they are evaluated for any flow, with flows without TCP
+	// flags having all flags unset.
+	TcpFlagsAnyProto bool
+	// The clock used by matches relative to the current time. Defaults to
+	// time.Now if unset.
+	Now func() time.Time
+	// The time zone used by time and weekday matches and timestamps without
+	// offset, unless a match has its own. Defaults to UTC if unset.
+	Location *time.Location
+	// By default, matches on fields filled by enrichment compare missing
+	// fields as empty or zero. If set, such matches are unknown instead,
+	// which propagates through `not`, `and` and `or` as in three-valued
+	// logic. The result of a filter which is unknown for a flow is given by
+	// MatchUnknown.
+	ThreeValued  bool
+	MatchUnknown bool
+	// By default, bytes, packets, bps and pps matches compare a flow's
+	// counters as exported, unless they are marked `scaled`. If set, all
+	// of them are scaled by the flow's sampling rate.
+	Scaled bool
+	// If set, country and continent matches resolve the addresses of flows
+	// which have not been enriched with the respective country.
+	GeoIP GeoIP
+	// If set, rpki matches validate flows which have not been validated by
+	// enrichment. It is required by `src rpki` and `dst rpki` matches, which
+	// error without it.
+	RPKIValidator RPKIValidator
+	// If set, asn matches resolve the addresses of flows which have not
+	// been exported with the respective AS.
+	ASNResolver ASNResolver
+
+	flowmsg *pb.EnrichedFlow
 }
 
 func processNumericRange(node parser.NumericRange, compare uint64) (bool, error) {
@@ -38,9 +74,434 @@ func processNumericRange(node parser.NumericRange, compare uint64) (bool, error)
 	return false, err
 }
 
+// matchMac checks whether a flow's mac address starts with the given octets.
+// Flows carry the first octet in the least significant byte, as is assumed
+// by pb.MacToString.
+func matchMac(mac uint64, prefix parser.MacAddress) bool {
+	for i, octet := range prefix {
+		if byte(mac>>(8*i)) != octet {
+			return false
+		}
+	}
+	return true
+}
+
+// mplsStack returns the labels and ttls of a flow's label stack, top first.
+// Exporters either report the whole stack, or the first three entries and the
+// last one.
+func mplsStack(flowmsg *pb.EnrichedFlow) ([]uint32, []uint32) {
+	if len(flowmsg.MplsLabel) > 0 {
+		return flowmsg.MplsLabel, flowmsg.MplsTtl
+	}
+	if !flowmsg.HasMpls {
+		return nil, nil
+	}
+	labels := []uint32{flowmsg.Mpls_1Label, flowmsg.Mpls_2Label, flowmsg.Mpls_3Label}
+	ttls := []uint32{flowmsg.Mpls_1Ttl, flowmsg.Mpls_2Ttl, flowmsg.Mpls_3Ttl}
+	if flowmsg.MplsCount < 3 {
+		return labels[:flowmsg.MplsCount], ttls[:flowmsg.MplsCount]
+	}
+	if flowmsg.MplsCount > 3 {
+		labels = append(labels, flowmsg.MplsLastLabel)
+		ttls = append(ttls, flowmsg.MplsLastTtl)
+	}
+	return labels, ttls
+}
+
+// innerFlow returns a flow describing the innermost IP header of a tunneled
+// flow, based on its layer stack. The flow format has no fields for inner
+// addresses, only Etype and Proto are set. The boolean is false if the flow
+// has less than two IP headers.
+func innerFlow(flowmsg *pb.EnrichedFlow) (*pb.EnrichedFlow, bool) {
+	inner := &pb.EnrichedFlow{}
+	headers := 0
+	for _, layer := range flowmsg.LayerStack {
+		switch layer {
+		case pb.EnrichedFlow_IPv4:
+			inner.Etype, inner.Proto = 0x0800, 0
+			headers++
+		case pb.EnrichedFlow_IPv6:
+			inner.Etype, inner.Proto = 0x86DD, 0
+			headers++
+		default:
+			if headers == 0 || inner.Proto != 0 {
+				continue
+			}
+			switch layer {
+			case pb.EnrichedFlow_ICMP:
+				inner.Proto = 1
+			case pb.EnrichedFlow_TCP:
+				inner.Proto = 6
+			case pb.EnrichedFlow_UDP:
+				inner.Proto = 17
+			case pb.EnrichedFlow_GRE:
+				inner.Proto = 47
+			case pb.EnrichedFlow_ICMPv6:
+				inner.Proto = 58
+			}
+		}
+	}
+	return inner, headers > 1
+}
+
+// matchAddressPrefixes checks whether an address is matched by any of the
+// given prefixes. Nil prefixes are skipped.
+func matchAddressPrefixes(address net.IP, prefixes ...*parser.AddressPrefix) bool {
+	for _, prefix := range prefixes {
+		if prefix == nil {
+			continue
+		}
+		if prefix.Mask == nil {
+			if address.Equal(*prefix.Address) {
+				return true
+			}
+			continue
+		}
+		bits := 128
+		if prefix.Address.To4() != nil {
+			bits = 32
+		}
+		ipnet := &net.IPNet{IP: *prefix.Address, Mask: net.CIDRMask(int(*prefix.Mask), bits)}
+		if ipnet.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix checks whether the routed prefix of an address, given by its
+// netsize, is matched by a prefix match. Flows without netsize never match.
+func matchPrefix(node *parser.PrefixMatch, address net.IP, netsize uint32) bool {
+	bits := node.Bits()
+	if (address.To4() != nil) != (bits == 32) || netsize == 0 || int(netsize) > bits {
+		return false
+	}
+	mask := net.CIDRMask(int(*node.Mask), bits)
+	prefix := &net.IPNet{IP: node.Address.Mask(mask), Mask: mask}
+	if !prefix.Contains(address) {
+		return false
+	}
+	length, prefixLength := int(netsize), int(*node.Mask)
+	switch {
+	case node.OrLonger:
+		return length >= prefixLength
+	case node.Longer:
+		return length > prefixLength
+	case node.UpTo != nil:
+		return length >= prefixLength && length <= int(*node.UpTo)
+	default:
+		return length == prefixLength
+	}
+}
+
+// Getters for the fields in parser.ComparableFields. Mac addresses are
+// compared as numbers, as only equality is defined for them.
+var (
+	numberFields = map[string]func(*pb.EnrichedFlow) uint64{
+		"src asn":       func(m *pb.EnrichedFlow) uint64 { return uint64(m.SrcAs) },
+		"dst asn":       func(m *pb.EnrichedFlow) uint64 { return uint64(m.DstAs) },
+		"src port":      func(m *pb.EnrichedFlow) uint64 { return uint64(m.SrcPort) },
+		"dst port":      func(m *pb.EnrichedFlow) uint64 { return uint64(m.DstPort) },
+		"src iface":     func(m *pb.EnrichedFlow) uint64 { return uint64(m.InIf) },
+		"dst iface":     func(m *pb.EnrichedFlow) uint64 { return uint64(m.OutIf) },
+		"src netsize":   func(m *pb.EnrichedFlow) uint64 { return uint64(m.SrcNet) },
+		"dst netsize":   func(m *pb.EnrichedFlow) uint64 { return uint64(m.DstNet) },
+		"src cid":       func(m *pb.EnrichedFlow) uint64 { return uint64(m.SrcCid) },
+		"dst cid":       func(m *pb.EnrichedFlow) uint64 { return uint64(m.DstCid) },
+		"src vrf":       func(m *pb.EnrichedFlow) uint64 { return uint64(m.IngressVrfId) },
+		"dst vrf":       func(m *pb.EnrichedFlow) uint64 { return uint64(m.EgressVrfId) },
+		"src vlan":      func(m *pb.EnrichedFlow) uint64 { return uint64(m.SrcVlan) },
+		"dst vlan":      func(m *pb.EnrichedFlow) uint64 { return uint64(m.DstVlan) },
+		"src mac":       func(m *pb.EnrichedFlow) uint64 { return m.SrcMac },
+		"dst mac":       func(m *pb.EnrichedFlow) uint64 { return m.DstMac },
+		"inif":          func(m *pb.EnrichedFlow) uint64 { return uint64(m.InIf) },
+		"outif":         func(m *pb.EnrichedFlow) uint64 { return uint64(m.OutIf) },
+		"nexthopasn":    func(m *pb.EnrichedFlow) uint64 { return uint64(m.NextHopAs) },
+		"bytes":         func(m *pb.EnrichedFlow) uint64 { return m.Bytes },
+		"packets":       func(m *pb.EnrichedFlow) uint64 { return m.Packets },
+		"proto":         func(m *pb.EnrichedFlow) uint64 { return uint64(m.Proto) },
+		"etype":         func(m *pb.EnrichedFlow) uint64 { return uint64(m.Etype) },
+		"iptos":         func(m *pb.EnrichedFlow) uint64 { return uint64(m.IpTos) },
+		"ttl":           func(m *pb.EnrichedFlow) uint64 { return uint64(m.IpTtl) },
+		"samplingrate":  func(m *pb.EnrichedFlow) uint64 { return m.SamplingRate },
+		"med":           func(m *pb.EnrichedFlow) uint64 { return uint64(m.Med) },
+		"localpref":     func(m *pb.EnrichedFlow) uint64 { return uint64(m.LocalPref) },
+		"cid":           func(m *pb.EnrichedFlow) uint64 { return uint64(m.Cid) },
+		"vlan":          func(m *pb.EnrichedFlow) uint64 { return uint64(m.VlanId) },
+		"timeflowstart": func(m *pb.EnrichedFlow) uint64 { return m.TimeFlowStart },
+		"timeflowend":   func(m *pb.EnrichedFlow) uint64 { return m.TimeFlowEnd },
+		"timereceived":  func(m *pb.EnrichedFlow) uint64 { return m.TimeReceived },
+		"duration": func(m *pb.EnrichedFlow) uint64 {
+			if m.TimeFlowEnd < m.TimeFlowStart {
+				return 0
+			}
+			return m.TimeFlowEnd - m.TimeFlowStart
+		},
+	}
+	addressFields = map[string]func(*pb.EnrichedFlow) net.IP{
+		"src address": func(m *pb.EnrichedFlow) net.IP { return m.SrcAddr },
+		"dst address": func(m *pb.EnrichedFlow) net.IP { return m.DstAddr },
+		"router":      func(m *pb.EnrichedFlow) net.IP { return m.SamplerAddress },
+		"nexthop":     func(m *pb.EnrichedFlow) net.IP { return m.NextHop },
+	}
+	// Getters for the fields in parser.PresenceFields.
+	presenceFields = map[string]func(*pb.EnrichedFlow) bool{
+		"country":         func(m *pb.EnrichedFlow) bool { return m.RemoteCountry != "" },
+		"src country":     func(m *pb.EnrichedFlow) bool { return m.SrcCountry != "" },
+		"dst country":     func(m *pb.EnrichedFlow) bool { return m.DstCountry != "" },
+		"cid":             func(m *pb.EnrichedFlow) bool { return m.Cid != 0 },
+		"src cid":         func(m *pb.EnrichedFlow) bool { return m.SrcCid != 0 },
+		"dst cid":         func(m *pb.EnrichedFlow) bool { return m.DstCid != 0 },
+		"src iface name":  func(m *pb.EnrichedFlow) bool { return m.SrcIfName != "" },
+		"dst iface name":  func(m *pb.EnrichedFlow) bool { return m.DstIfName != "" },
+		"src iface desc":  func(m *pb.EnrichedFlow) bool { return m.SrcIfDesc != "" },
+		"dst iface desc":  func(m *pb.EnrichedFlow) bool { return m.DstIfDesc != "" },
+		"src iface speed": func(m *pb.EnrichedFlow) bool { return m.SrcIfSpeed != 0 },
+		"dst iface speed": func(m *pb.EnrichedFlow) bool { return m.DstIfSpeed != 0 },
+		"src asn":         func(m *pb.EnrichedFlow) bool { return m.SrcAs != 0 },
+		"dst asn":         func(m *pb.EnrichedFlow) bool { return m.DstAs != 0 },
+		"nexthopasn":      func(m *pb.EnrichedFlow) bool { return m.NextHopAs != 0 },
+		"aspath":          func(m *pb.EnrichedFlow) bool { return len(m.AsPath) > 0 },
+		"rpki":            func(m *pb.EnrichedFlow) bool { return m.ValidationStatus != 0 },
+		"src rpki":        func(m *pb.EnrichedFlow) bool { return false }, // only validated locally
+		"dst rpki":        func(m *pb.EnrichedFlow) bool { return false },
+		"med":             func(m *pb.EnrichedFlow) bool { return m.Med != 0 },
+		"localpref":       func(m *pb.EnrichedFlow) bool { return m.LocalPref != 0 },
+	}
+)
+
+// compare evaluates a comparison, which parser.Parse ensures to be valid.
+// Comparisons which divide by zero never match and are undefined, which is
+// signaled by ok being false.
+func compare(flowmsg *pb.EnrichedFlow, node *parser.Comparison) (result, ok bool) {
+	var cmp int
+	if field := node.Left.Field(); field != nil && addressFields[field.Name()] != nil {
+		left, right := addressFields[field.Name()], addressFields[node.Right.Field().Name()]
+		cmp = bytes.Compare(left(flowmsg).To16(), right(flowmsg).To16())
+	} else {
+		left, leftOk := evaluate(flowmsg, node.Left)
+		right, rightOk := evaluate(flowmsg, node.Right)
+		if !leftOk || !rightOk {
+			return false, false
+		}
+		switch {
+		case left < right:
+			cmp = -1
+		case left > right:
+			cmp = 1
+		}
+	}
+	switch *node.Operator {
+	case "==":
+		return cmp == 0, true
+	case "!=":
+		return cmp != 0, true
+	case "<":
+		return cmp < 0, true
+	case ">":
+		return cmp > 0, true
+	case "<=":
+		return cmp <= 0, true
+	case ">=":
+		return cmp >= 0, true
+	}
+	return false, true
+}
+
+// evaluate computes an arithmetic expression for a flow. Instead of wrapping
+// around, results saturate at 0 and the maximum uint64. Division by zero is
+// undefined, which is signaled by ok being false.
+func evaluate(flowmsg *pb.EnrichedFlow, sum *parser.Sum) (uint64, bool) {
+	value, ok := evaluateProduct(flowmsg, sum.Left)
+	for _, op := range sum.Right {
+		right, rightOk := evaluateProduct(flowmsg, op.Right)
+		ok = ok && rightOk
+		switch *op.Operator {
+		case "+":
+			if total, carry := bits.Add64(value, right, 0); carry != 0 {
+				value = math.MaxUint64
+			} else {
+				value = total
+			}
+		case "-":
+			if difference, borrow := bits.Sub64(value, right, 0); borrow != 0 {
+				value = 0
+			} else {
+				value = difference
+			}
+		}
+	}
+	return value, ok
+}
+
+func evaluateProduct(flowmsg *pb.EnrichedFlow, product *parser.Product) (uint64, bool) {
+	value, ok := evaluateOperand(flowmsg, product.Left)
+	for _, op := range product.Right {
+		right, rightOk := evaluateOperand(flowmsg, op.Right)
+		ok = ok && rightOk
+		switch *op.Operator {
+		case "*":
+			value = mulSaturating(value, right)
+		case "/":
+			if right == 0 {
+				return 0, false
+			}
+			value /= right
+		}
+	}
+	return value, ok
+}
+
+func evaluateOperand(flowmsg *pb.EnrichedFlow, operand *parser.Operand) (uint64, bool) {
+	switch {
+	case operand.Number != nil:
+		return uint64(*operand.Number), true
+	case operand.Field != nil:
+		return numberFields[operand.Field.Name()](flowmsg), true
+	default:
+		return evaluate(flowmsg, operand.Sum)
+	}
+}
+
+// scale multiplies a sampled counter by the flow's sampling rate, if the
+// range asks for it and the flow is not normalized already. A sampling rate
+// of 0 means the rate is unknown, such flows are treated as unsampled.
+func (f *Filter) scale(node parser.ScaledRange, value uint64) uint64 {
+	if !node.Scaled && !f.Scaled || f.flowmsg.Normalized == 1 || f.flowmsg.SamplingRate == 0 {
+		return value
+	}
+	return mulSaturating(value, f.flowmsg.SamplingRate)
+}
+
+// mulSaturating multiplies two numbers, saturating at the maximum uint64
+// instead of wrapping around.
+func mulSaturating(a, b uint64) uint64 {
+	if hi, lo := bits.Mul64(a, b); hi == 0 {
+		return lo
+	}
+	return math.MaxUint64
+}
+
+// unknown returns whether a flow lacks a field filled by enrichment, as far
+// as three-valued filters are concerned.
+func (f *Filter) unknown(field string) bool {
+	_, ok := presenceFields[field]
+	return f.ThreeValued && ok && !f.present(field)
+}
+
+// present returns whether a flow carries a field filled by enrichment, which
+// for countries includes those resolved by GeoIP.
+func (f *Filter) present(field string) bool {
+	switch field {
+	case "country", "src country", "dst country":
+		return f.country(field) != ""
+	case "src asn", "dst asn":
+		return f.asn(field) != 0
+	case "rpki", "src rpki", "dst rpki":
+		return f.rpki(field) != pb.EnrichedFlow_Unknown
+	}
+	return presenceFields[field](f.flowmsg)
+}
+
+// country returns a flow's upper case country code for the field `country`,
+// `src country` or `dst country`. If the flow has not been enriched, the
+// respective address is resolved using GeoIP, if set. The remote address is
+// the source address of incoming flows and the destination address otherwise.
+func (f *Filter) country(field string) string {
+	var country string
+	var address []byte
+	switch field {
+	case "src country":
+		country, address = f.flowmsg.SrcCountry, f.flowmsg.SrcAddr
+	case "dst country":
+		country, address = f.flowmsg.DstCountry, f.flowmsg.DstAddr
+	default:
+		country, address = f.flowmsg.RemoteCountry, f.flowmsg.SrcAddr
+		if f.flowmsg.FlowDirection == 1 {
+			address = f.flowmsg.DstAddr
+		}
+	}
+	if country == "" && f.GeoIP != nil && len(address) > 0 {
+		country = f.GeoIP.Country(net.IP(address))
+	}
+	return strings.ToUpper(country)
+}
+
+// asn returns a flow's AS for the field `src asn` or `dst asn`. If it is
+// zero, the respective address is resolved using ASNResolver, if set.
+func (f *Filter) asn(field string) uint32 {
+	as, address := f.flowmsg.SrcAs, f.flowmsg.SrcAddr
+	if field == "dst asn" {
+		as, address = f.flowmsg.DstAs, f.flowmsg.DstAddr
+	}
+	if as == 0 && f.ASNResolver != nil && len(address) > 0 {
+		as = f.ASNResolver.OriginAsn(net.IP(address))
+	}
+	return as
+}
+
+// rpki returns a flow's validation status for the field `rpki`, `src rpki`
+// or `dst rpki`. The latter validate the respective prefix and origin AS
+// using RPKIValidator, while the former is the status set by enrichment,
+// falling back to validating the remote prefix. Without netsize or AS, the
+// status is unknown.
+func (f *Filter) rpki(field string) pb.EnrichedFlow_ValidationStatusType {
+	if field == "rpki" {
+		if f.flowmsg.ValidationStatus != pb.EnrichedFlow_Unknown || f.RPKIValidator == nil {
+			return f.flowmsg.ValidationStatus
+		}
+		field = "src rpki"
+		if f.flowmsg.FlowDirection == 1 {
+			field = "dst rpki"
+		}
+	}
+	if f.RPKIValidator == nil {
+		return pb.EnrichedFlow_Unknown
+	}
+	address, netsize, as := net.IP(f.flowmsg.SrcAddr), int(f.flowmsg.SrcNet), f.asn("src asn")
+	if field == "dst rpki" {
+		address, netsize, as = net.IP(f.flowmsg.DstAddr), int(f.flowmsg.DstNet), f.asn("dst asn")
+	}
+	bits := 128
+	if address.To4() != nil {
+		address, bits = address.To4(), 32
+	}
+	if address == nil || netsize == 0 || netsize > bits || as == 0 {
+		return pb.EnrichedFlow_Unknown
+	}
+	mask := net.CIDRMask(netsize, bits)
+	return f.RPKIValidator.Validate(&net.IPNet{IP: address.Mask(mask), Mask: mask}, as)
+}
+
+// or3 and and3 combine results as in Kleene's three-valued logic. The values
+// of unknown results are ignored.
+func or3(a bool, aUnknown bool, b bool, bUnknown bool) (bool, bool) {
+	if a && !aUnknown || b && !bUnknown {
+		return true, false
+	}
+	return false, aUnknown || bUnknown
+}
+
+func and3(a bool, aUnknown bool, b bool, bUnknown bool) (bool, bool) {
+	if !a && !aUnknown || !b && !bUnknown {
+		return false, false
+	}
+	return !(aUnknown || bUnknown), aUnknown || bUnknown
+}
+
+func (f *Filter) now() time.Time {
+	if f.Now == nil {
+		return time.Now()
+	}
+	return f.Now()
+}
+
 func (f *Filter) CheckFlow(expr *parser.Expression, flowmsg *pb.EnrichedFlow) (bool, error) {
 	f.flowmsg = flowmsg                // provide current flow to actual Visitor
 	err := parser.Visit(expr, f.Visit) // run the Visitor
+	if expr.EvalUnknown {
+		return f.MatchUnknown, err
+	}
 	return expr.EvalResult, err
 }
 
@@ -52,52 +513,119 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 	switch node := n.(type) {
 	case *parser.AddressMatch:
 	case *parser.Address:
+	case *parser.AddressPrefix:
+	case *parser.AgeRangeMatch:
+	case *parser.AsPathFirstRangeMatch:
+	case *parser.AsPathLengthRangeMatch:
+	case *parser.AsPathMatch:
+	case *parser.AsPathOriginRangeMatch:
+	case *parser.AsPathRegex:
 	case *parser.AsnRangeMatch:
 	case *parser.Boolean:
 	case *parser.BpsRangeMatch:
 	case *parser.ByteRangeMatch:
 	case *parser.CidRangeMatch:
+	case *parser.Comparison:
+	case *parser.Continent:
+	case *parser.ContinentMatch:
+	case *parser.CountryCode:
+	case *parser.CountryMatch:
+	case *parser.CustomerMatch:
 	case *parser.DirectionalMatchGroup:
+	case *parser.Duration:
 	case *parser.DurationRangeMatch:
+	case *parser.DscpClass:
 	case *parser.DscpKey:
 	case *parser.DscpMatch:
 	case *parser.EcnKey:
 	case *parser.EcnMatch:
+	case *parser.EncapMatch:
+		// evaluate children against the inner header instead of descending
+		inner, ok := innerFlow(f.flowmsg)
+		if node.Present || !ok {
+			(*node).EvalResult = ok
+			return nil
+		}
+		filter := &Filter{TcpFlagsAnyProto: f.TcpFlagsAnyProto, flowmsg: inner}
+		if node.Etype != nil {
+			err := parser.Visit(node.Etype, filter.Visit)
+			(*node).EvalResult = node.Etype.EvalResult
+			return err
+		}
+		err := parser.Visit(node.Proto, filter.Visit)
+		(*node).EvalResult = node.Proto.EvalResult
+		return err
 	case *parser.EtypeKey:
 	case *parser.EtypeMatch:
 	case *parser.Expression:
+	case *parser.FieldRef:
 	case *parser.FlowDirectionMatch:
+	case *parser.FlowLabelRangeMatch:
+	case *parser.FlowTypeKey:
+	case *parser.FlowTypeMatch:
+	case *parser.FragmentIdRangeMatch:
+	case *parser.FragmentMatch:
+	case *parser.FragmentOffsetRangeMatch:
+	case *parser.HasMatch:
 	case *parser.IcmpMatch:
+	case *parser.IcmpMessage:
+	case *parser.IcmpRangeMatch:
 	case *parser.IfSpeedRangeMatch:
+	case *parser.InterfaceKey:
 	case *parser.InterfaceMatch:
 	case *parser.IpTosRangeMatch:
+	case *parser.Location:
+	case *parser.MacAddress:
+	case *parser.MacMatch:
 	case *parser.MedRangeMatch:
 	case *parser.LocalPrefRangeMatch:
+	case *parser.MplsDepthRangeMatch:
+	case *parser.MplsLabelRangeMatch:
+	case *parser.MplsMatch:
+	case *parser.MplsTtlRangeMatch:
 	case *parser.NetsizeRangeMatch:
 	case *parser.NextHopMatch:
 	case *parser.NextHopAsnMatch:
 	case *parser.NormalizedMatch:
 	case *parser.Number:
+	case *parser.NumericRange:
+	case *parser.Operand:
 	case *parser.PacketRangeMatch:
+	case *parser.PortMatch:
 	case *parser.PortRangeMatch:
 	case *parser.PpsRangeMatch:
 	case *parser.PassesThroughListMatch:
+	case *parser.PrefixMatch:
+	case *parser.Product:
+	case *parser.ProductOperation:
 	case *parser.ProtoKey:
 	case *parser.ProtoMatch:
 	case *parser.RangeEnd:
 	case *parser.RegularMatchGroup:
-	case *parser.RemoteCountryMatch:
 	case *parser.RouterMatch:
 	case *parser.RpkiKey:
 	case *parser.RpkiMatch:
 	case *parser.SamplingRateRangeMatch:
+	case *parser.SequenceNumRangeMatch:
+	case *parser.ServiceKey:
 	case *parser.Statement:
+	case *parser.StatusClass:
 	case *parser.StatusKey:
 	case *parser.StatusMatch:
+	case *parser.StatusRangeMatch:
 	case *parser.String:
+	case *parser.Sum:
+	case *parser.SumOperation:
 	case *parser.TcpFlagsKey:
 	case *parser.TcpFlagsMatch:
+	case *parser.TimeMatch:
+	case *parser.TimeOfDay:
+	case *parser.TimeOfDayRange:
+	case *parser.Timestamp:
+	case *parser.TtlRangeMatch:
+	case *parser.VlanRangeMatch:
 	case *parser.VrfRangeMatch:
+	case *parser.WeekdayRange:
 	default:
 		return fmt.Errorf("Encountered unknown node type: %T", node)
 	}
@@ -126,9 +654,84 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 			(*node).EvalResultSrc = net.IP(f.flowmsg.SrcAddr).Equal(*node.Address)
 			(*node).EvalResultDst = net.IP(f.flowmsg.DstAddr).Equal(*node.Address)
 		}
+	case *parser.PrefixMatch:
+		(*node).EvalResultSrc = matchPrefix(node, f.flowmsg.SrcAddr, f.flowmsg.SrcNet)
+		(*node).EvalResultDst = matchPrefix(node, f.flowmsg.DstAddr, f.flowmsg.DstNet)
+	case *parser.AgeRangeMatch:
+		var age uint64
+		if now := uint64(f.now().Unix()); now > f.flowmsg.TimeReceived {
+			age = now - f.flowmsg.TimeReceived
+		}
+		(*node).EvalResult, err = processNumericRange(node.NumericRange(), age)
+		if err != nil {
+			return fmt.Errorf("Bad age range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
+		// flows without a time of reception have no age
+		(*node).EvalResult = node.EvalResult && f.flowmsg.TimeReceived != 0
+	case *parser.AsPathFirstRangeMatch:
+		var first uint64
+		if len(f.flowmsg.AsPath) > 0 {
+			first = uint64(f.flowmsg.AsPath[0])
+		}
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, first)
+		if err != nil {
+			return fmt.Errorf("Bad aspath first range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
+		(*node).EvalResult = node.EvalResult && len(f.flowmsg.AsPath) > 0
+	case *parser.AsPathLengthRangeMatch:
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, uint64(len(f.flowmsg.AsPath)))
+		if err != nil {
+			return fmt.Errorf("Bad aspath length range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
+	case *parser.AsPathMatch:
+		switch {
+		case node.Regex != nil:
+			(*node).EvalResult = node.Regex.Regexp.MatchString(parser.AsPathString(f.flowmsg.AsPath))
+		case node.Length != nil:
+			(*node).EvalResult = node.Length.EvalResult
+		case node.Origin != nil:
+			(*node).EvalResult = node.Origin.EvalResult
+		case node.First != nil:
+			(*node).EvalResult = node.First.EvalResult
+		case node.Prepended:
+			(*node).EvalResult = false
+			for i := 1; i < len(f.flowmsg.AsPath); i++ {
+				if f.flowmsg.AsPath[i] == f.flowmsg.AsPath[i-1] {
+					(*node).EvalResult = true
+					break
+				}
+			}
+		case node.ContainsPrivate:
+			// private use ASNs as per RFC 6996
+			(*node).EvalResult = false
+			for _, asn := range f.flowmsg.AsPath {
+				if 64512 <= asn && asn <= 65534 || 4200000000 <= asn && asn <= 4294967294 {
+					(*node).EvalResult = true
+					break
+				}
+			}
+		}
+	case *parser.AsPathOriginRangeMatch:
+		var origin uint64
+		if len(f.flowmsg.AsPath) > 0 {
+			origin = uint64(f.flowmsg.AsPath[len(f.flowmsg.AsPath)-1])
+		}
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, origin)
+		if err != nil {
+			return fmt.Errorf("Bad aspath origin range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
+		(*node).EvalResult = node.EvalResult && len(f.flowmsg.AsPath) > 0
 	case *parser.AsnRangeMatch:
-		(*node).EvalResultSrc, _ = processNumericRange(node.NumericRange, uint64(f.flowmsg.SrcAs))
-		(*node).EvalResultDst, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.DstAs))
+		(*node).EvalResultSrc, _ = processNumericRange(node.NumericRange, uint64(f.asn("src asn")))
+		(*node).EvalResultDst, err = processNumericRange(node.NumericRange, uint64(f.asn("dst asn")))
 		if err != nil { // errs from above calls will be the same anyways
 			return fmt.Errorf("Bad ASN range, lower %d > upper %d",
 				*node.Lower,
@@ -139,10 +742,10 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 		if duration == 0 {
 			duration += 1
 		}
-		bps := f.flowmsg.Bytes * 8 / duration
+		bps := mulSaturating(f.scale(node.ScaledRange, f.flowmsg.Bytes), 8) / duration
 		(*node).EvalResult, err = processNumericRange(node.NumericRange, bps)
 	case *parser.ByteRangeMatch:
-		(*node).EvalResult, err = processNumericRange(node.NumericRange, f.flowmsg.Bytes)
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, f.scale(node.ScaledRange, f.flowmsg.Bytes))
 		if err != nil {
 			return fmt.Errorf("Bad byte size range, lower %d > upper %d",
 				*node.Lower,
@@ -157,6 +760,14 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 				*node.Lower,
 				*node.Upper)
 		}
+	case *parser.Comparison:
+		var ok bool
+		(*node).EvalResult, ok = compare(f.flowmsg, node)
+		(*node).EvalUnknown = !ok && f.ThreeValued
+	case *parser.CustomerMatch:
+		_, (*node).EvalResult = slices.BinarySearch(node.Cids, f.flowmsg.Cid)
+		_, (*node).EvalResultSrc = slices.BinarySearch(node.Cids, f.flowmsg.SrcCid)
+		_, (*node).EvalResultDst = slices.BinarySearch(node.Cids, f.flowmsg.DstCid)
 	case *parser.RegularMatchGroup:
 		switch {
 		case node.Router != nil:
@@ -169,8 +780,6 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 			(*node).EvalResult = node.Bytes.EvalResult
 		case node.Packets != nil:
 			(*node).EvalResult = node.Packets.EvalResult
-		case node.RemoteCountry != nil:
-			(*node).EvalResult = node.RemoteCountry.EvalResult
 		case node.FlowDirection != nil:
 			(*node).EvalResult = node.FlowDirection.EvalResult
 		case node.Normalized != nil:
@@ -205,61 +814,143 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 			(*node).EvalResult = node.Pps.EvalResult
 		case node.PassesThrough != nil:
 			(*node).EvalResult = node.PassesThrough.EvalResult
-		case node.Rpki != nil:
-			(*node).EvalResult = node.Rpki.EvalResult
+		case node.Mpls != nil:
+			(*node).EvalResult = node.Mpls.EvalResult
+		case node.Encap != nil:
+			(*node).EvalResult = node.Encap.EvalResult
+		case node.Ttl != nil:
+			(*node).EvalResult = node.Ttl.EvalResult
+		case node.FlowLabel != nil:
+			(*node).EvalResult = node.FlowLabel.EvalResult
+		case node.FragmentId != nil:
+			(*node).EvalResult = node.FragmentId.EvalResult
+		case node.FragmentOffset != nil:
+			(*node).EvalResult = node.FragmentOffset.EvalResult
+		case node.Fragment != nil:
+			(*node).EvalResult = node.Fragment.EvalResult
+		case node.FlowType != nil:
+			(*node).EvalResult = node.FlowType.EvalResult
+		case node.Age != nil:
+			(*node).EvalResult = node.Age.EvalResult
+		case node.SequenceNum != nil:
+			(*node).EvalResult = node.SequenceNum.EvalResult
+		case node.AsPath != nil:
+			(*node).EvalResult = node.AsPath.EvalResult
+		case node.Time != nil:
+			(*node).EvalResult = node.Time.EvalResult
+		case node.Has != nil:
+			(*node).EvalResult = node.Has.EvalResult
+		}
+		var field string // the enriched field this match depends on, if any
+		switch {
+		case node.NextHopAsn != nil:
+			field = "nexthopasn"
+		case node.AsPath != nil:
+			field = "aspath"
+		case node.Med != nil:
+			field = "med"
+		case node.LocalPref != nil:
+			field = "localpref"
 		}
+		(*node).EvalUnknown = f.unknown(field)
 	case *parser.DirectionalMatchGroup:
-		if node.Direction == nil {
-			switch {
-			case node.Address != nil:
-				(*node).EvalResult = node.Address.EvalResultSrc || node.Address.EvalResultDst
-			case node.Interface != nil:
-				(*node).EvalResult = node.Interface.EvalResultSrc || node.Interface.EvalResultDst
-			case node.Port != nil:
-				(*node).EvalResult = node.Port.EvalResultSrc || node.Port.EvalResultDst
-			case node.Asn != nil:
-				(*node).EvalResult = node.Asn.EvalResultSrc || node.Asn.EvalResultDst
-			case node.Netsize != nil:
-				(*node).EvalResult = node.Netsize.EvalResultSrc || node.Netsize.EvalResultDst
-			case node.Cid != nil:
-				(*node).EvalResult = node.Cid.EvalResult || node.Cid.EvalResultSrc || node.Cid.EvalResultDst
-			case node.Vrf != nil:
-				(*node).EvalResult = node.Vrf.EvalResultSrc || node.Vrf.EvalResultDst
-			}
-		} else if *node.Direction == "src" {
-			switch {
-			case node.Address != nil:
-				(*node).EvalResult = node.Address.EvalResultSrc
-			case node.Interface != nil:
-				(*node).EvalResult = node.Interface.EvalResultSrc
-			case node.Port != nil:
-				(*node).EvalResult = node.Port.EvalResultSrc
-			case node.Asn != nil:
-				(*node).EvalResult = node.Asn.EvalResultSrc
-			case node.Netsize != nil:
-				(*node).EvalResult = node.Netsize.EvalResultSrc
-			case node.Cid != nil:
-				(*node).EvalResult = node.Cid.EvalResultSrc
-			case node.Vrf != nil:
-				(*node).EvalResult = node.Vrf.EvalResultSrc
-			}
-		} else if *node.Direction == "dst" {
-			switch {
-			case node.Address != nil:
-				(*node).EvalResult = node.Address.EvalResultDst
-			case node.Interface != nil:
-				(*node).EvalResult = node.Interface.EvalResultDst
-			case node.Port != nil:
-				(*node).EvalResult = node.Port.EvalResultDst
-			case node.Asn != nil:
-				(*node).EvalResult = node.Asn.EvalResultDst
-			case node.Netsize != nil:
-				(*node).EvalResult = node.Netsize.EvalResultDst
-			case node.Cid != nil:
-				(*node).EvalResult = node.Cid.EvalResultDst
-			case node.Vrf != nil:
-				(*node).EvalResult = node.Vrf.EvalResultDst
+		var direction string
+		if node.Direction != nil {
+			direction = string(*node.Direction)
+			if node.Rpki != nil && f.RPKIValidator == nil {
+				return fmt.Errorf("Directional rpki matches require an RPKIValidator")
+			}
+		}
+		// resolve aliases and directions relative to our network, flows
+		// are assumed to be exported on border interfaces
+		switch direction {
+		case "ingress":
+			direction = "src"
+		case "egress":
+			direction = "dst"
+		case "local":
+			direction = "dst"
+			if f.flowmsg.FlowDirection == 1 {
+				direction = "src"
+			}
+		case "remote":
+			direction = "src"
+			if f.flowmsg.FlowDirection == 1 {
+				direction = "dst"
+			}
+			if (node.Country != nil || node.Continent != nil) && f.flowmsg.RemoteCountry != "" {
+				direction = "flow" // enrichment knows the remote country
+			}
+		case "either":
+			direction = ""
+		case "":
+			if node.Rpki != nil || node.Country != nil || node.Continent != nil {
+				direction = "flow" // the flow's status and the remote country, as before directions
+			}
+		}
+		var results parser.BranchNode
+		switch {
+		case node.Address != nil:
+			results = node.Address.BranchNode
+		case node.Interface != nil:
+			results = node.Interface.BranchNode
+		case node.Port != nil:
+			results = node.Port.BranchNode
+		case node.Asn != nil:
+			results = node.Asn.BranchNode
+		case node.Netsize != nil:
+			results = node.Netsize.BranchNode
+		case node.Cid != nil:
+			results = node.Cid.BranchNode
+		case node.Vrf != nil:
+			results = node.Vrf.BranchNode
+		case node.Mac != nil:
+			results = node.Mac.BranchNode
+		case node.Vlan != nil:
+			results = node.Vlan.BranchNode
+		case node.Country != nil:
+			results = node.Country.BranchNode
+		case node.Continent != nil:
+			results = node.Continent.BranchNode
+		case node.Rpki != nil:
+			results = node.Rpki.BranchNode
+		case node.Prefix != nil:
+			results = node.Prefix.BranchNode
+		case node.Customer != nil:
+			results = node.Customer.BranchNode
+		}
+		var field string // the enriched field this match depends on, if any
+		switch {
+		case node.Asn != nil:
+			field = "asn"
+		case node.Cid != nil || node.Customer != nil:
+			field = "cid"
+		case node.Country != nil || node.Continent != nil:
+			field = "country"
+		case node.Rpki != nil:
+			field = "rpki"
+		case node.Interface != nil && node.Interface.Name != nil:
+			field = "iface name"
+		case node.Interface != nil && node.Interface.Description != nil:
+			field = "iface desc"
+		case node.Interface != nil && node.Interface.Speed != nil:
+			field = "iface speed"
+		}
+		srcUnknown, dstUnknown := f.unknown("src "+field), f.unknown("dst "+field)
+		switch direction {
+		case "flow":
+			(*node).EvalResult, (*node).EvalUnknown = results.EvalResult, f.unknown(field)
+		case "":
+			(*node).EvalResult, (*node).EvalUnknown = or3(results.EvalResultSrc, srcUnknown, results.EvalResultDst, dstUnknown)
+			if field == "cid" || node.Vlan != nil || field == "country" { // these have a flow wide value too
+				(*node).EvalResult, (*node).EvalUnknown = or3(node.EvalResult, node.EvalUnknown, results.EvalResult, f.unknown(field))
 			}
+		case "src":
+			(*node).EvalResult, (*node).EvalUnknown = results.EvalResultSrc, srcUnknown
+		case "dst":
+			(*node).EvalResult, (*node).EvalUnknown = results.EvalResultDst, dstUnknown
+		case "both":
+			(*node).EvalResult, (*node).EvalUnknown = and3(results.EvalResultSrc, srcUnknown, results.EvalResultDst, dstUnknown)
 		}
 	case *parser.DurationRangeMatch:
 		(*node).EvalResult, err = processNumericRange(node.NumericRange, f.flowmsg.TimeFlowEnd-f.flowmsg.TimeFlowStart)
@@ -269,7 +960,18 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 				*node.Upper)
 		}
 	case *parser.DscpMatch:
+		dscp := f.flowmsg.IpTos >> 2
 		switch {
+		case node.Lower != nil:
+			if *node.Lower > *node.Upper {
+				return fmt.Errorf("Bad dscp range, lower %d > upper %d",
+					*node.Lower,
+					*node.Upper)
+			}
+			(*node).EvalResult = uint32(*node.Lower) <= dscp && dscp <= uint32(*node.Upper)
+		case node.DscpClass != nil:
+			// the class is followed by the drop precedence, 1 to 3
+			(*node).EvalResult = dscp>>3 == uint32(*node.DscpClass) && dscp&0b001 == 0 && dscp&0b110 != 0
 		case node.Dscp != nil:
 			(*node).EvalResult = f.flowmsg.IpTos>>2 == uint32(*node.Dscp)
 		case node.DscpKey != nil:
@@ -277,6 +979,8 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 		}
 	case *parser.EcnMatch:
 		switch {
+		case node.Capable:
+			(*node).EvalResult = f.flowmsg.IpTos&0b00000011 != 0
 		case node.Ecn != nil:
 			(*node).EvalResult = f.flowmsg.IpTos&0b00000011 == uint32(*node.Ecn)
 		case node.EcnKey != nil:
@@ -294,11 +998,11 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 		case node.Left == nil:
 			(*node).EvalResult = true // empty filters return all flows
 		case node.Conjunction == nil:
-			(*node).EvalResult = node.Left.EvalResult
+			(*node).EvalResult, (*node).EvalUnknown = node.Left.EvalResult, node.Left.EvalUnknown
 		case *node.Conjunction == "and":
-			(*node).EvalResult = node.Left.EvalResult && node.Right.EvalResult
+			(*node).EvalResult, (*node).EvalUnknown = and3(node.Left.EvalResult, node.Left.EvalUnknown, node.Right.EvalResult, node.Right.EvalUnknown)
 		case *node.Conjunction == "or":
-			(*node).EvalResult = node.Left.EvalResult || node.Right.EvalResult
+			(*node).EvalResult, (*node).EvalUnknown = or3(node.Left.EvalResult, node.Left.EvalUnknown, node.Right.EvalResult, node.Right.EvalUnknown)
 		}
 	case *parser.FlowDirectionMatch:
 		if *node.FlowDirection == "incoming" {
@@ -306,17 +1010,103 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 		} else if *node.FlowDirection == "outgoing" {
 			(*node).EvalResult = f.flowmsg.FlowDirection == 1
 		}
-	case *parser.IcmpMatch:
-		if f.flowmsg.Proto != 1 {
+	case *parser.FlowTypeMatch:
+		switch {
+		case node.FlowType != nil:
+			(*node).EvalResult = uint64(f.flowmsg.Type) == uint64(*node.FlowType)
+		case node.FlowTypeKey != nil:
+			(*node).EvalResult = uint64(f.flowmsg.Type) == uint64(*node.FlowTypeKey)
+		default:
 			(*node).EvalResult = false
-			break
+			for _, key := range node.FlowTypeKeys {
+				(*node).EvalResult = node.EvalResult || uint64(f.flowmsg.Type) == uint64(*key)
+			}
+		}
+	case *parser.FlowLabelRangeMatch:
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.Ipv6FlowLabel))
+		if err != nil {
+			return fmt.Errorf("Bad flowlabel range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
+	case *parser.FragmentIdRangeMatch:
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.FragmentId))
+		if err != nil {
+			return fmt.Errorf("Bad fragment id range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
+	case *parser.FragmentMatch:
+		// the lowest flag is 'more fragments', for IPv4 and IPv6 alike
+		moreFragments := f.flowmsg.IpFlags&0b1 != 0
+		switch *node.Fragment {
+		case "fragment":
+			(*node).EvalResult = moreFragments || f.flowmsg.FragmentOffset != 0
+		case "first-fragment":
+			(*node).EvalResult = moreFragments && f.flowmsg.FragmentOffset == 0
+		case "non-first-fragment":
+			(*node).EvalResult = f.flowmsg.FragmentOffset != 0
+		}
+	case *parser.FragmentOffsetRangeMatch:
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.FragmentOffset))
+		if err != nil {
+			return fmt.Errorf("Bad fragment offset range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
+	case *parser.HasMatch:
+		if name := node.Name(); (name == "src rpki" || name == "dst rpki") && f.RPKIValidator == nil {
+			return fmt.Errorf("Directional rpki matches require an RPKIValidator")
+		}
+		(*node).EvalResult = f.present(node.Name())
+	case *parser.IcmpMatch:
+		proto := uint32(1)
+		if *node.Version == "icmpv6" {
+			proto = 58
+		}
+		// use dedicated fields if the exporter set them, else fall
+		// back to decoding the destination port (Netflow v9)
+		icmpType, icmpCode := f.flowmsg.IcmpType, f.flowmsg.IcmpCode
+		if icmpType == 0 && icmpCode == 0 {
+			icmpType, icmpCode = f.flowmsg.DstPort/256, f.flowmsg.DstPort%256
+		}
+		matchRanges := func(ranges *parser.IcmpRangeMatch, compare uint32) (bool, error) {
+			if ranges.Range != nil {
+				return processNumericRange(*ranges.Range, uint64(compare))
+			}
+			for _, r := range ranges.Ranges {
+				if result, err := processNumericRange(*r, uint64(compare)); result || err != nil {
+					return result, err
+				}
+			}
+			return false, nil
+		}
+		matchMessage := func(message *parser.IcmpMessage) bool {
+			if message.Code == nil {
+				return icmpType == message.Type
+			}
+			return icmpType == message.Type && icmpCode == *message.Code
 		}
 		switch {
+		case node.TypeName != nil:
+			(*node).EvalResult = matchMessage(node.TypeName)
 		case node.Type != nil:
-			(*node).EvalResult = uint32(*node.Type) == f.flowmsg.DstPort/256
+			(*node).EvalResult, err = matchRanges(node.Type, icmpType)
 		case node.Code != nil:
-			(*node).EvalResult = uint32(*node.Code) == f.flowmsg.DstPort%256
+			(*node).EvalResult, err = matchRanges(node.Code, icmpCode)
+		case node.Message != nil:
+			(*node).EvalResult = matchMessage(node.Message)
+		default:
+			(*node).EvalResult = false
+			for _, message := range node.Messages {
+				(*node).EvalResult = node.EvalResult || matchMessage(message)
+			}
+		}
+		if err != nil {
+			return err
 		}
+		// check this last, as bad ranges should error on any flow
+		(*node).EvalResult = node.EvalResult && f.flowmsg.Proto == proto
 	case *parser.IfSpeedRangeMatch:
 		(*node).EvalResultSrc, _ = processNumericRange(node.NumericRange, uint64(f.flowmsg.SrcIfSpeed)/1000)
 		(*node).EvalResultDst, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.DstIfSpeed)/1000)
@@ -327,9 +1117,20 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 		}
 	case *parser.InterfaceMatch:
 		switch {
-		case node.SnmpId != nil:
-			(*node).EvalResultSrc = uint32(*node.SnmpId) == f.flowmsg.InIf
-			(*node).EvalResultDst = uint32(*node.SnmpId) == f.flowmsg.OutIf
+		case node.SnmpId != nil || node.SnmpIds != nil:
+			keys := node.SnmpIds
+			if node.SnmpId != nil {
+				keys = []*parser.InterfaceKey{node.SnmpId}
+			}
+			(*node).EvalResultSrc, (*node).EvalResultDst = false, false
+			for _, key := range keys {
+				id, router := key.Key()
+				if router != nil && !router.Equal(net.IP(f.flowmsg.SamplerAddress)) {
+					continue // SNMP IDs are unique per router only
+				}
+				(*node).EvalResultSrc = node.EvalResultSrc || id == f.flowmsg.InIf
+				(*node).EvalResultDst = node.EvalResultDst || id == f.flowmsg.OutIf
+			}
 		case node.Name != nil:
 			(*node).EvalResultSrc = strings.Contains(
 				strings.ToLower(f.flowmsg.SrcIfName),
@@ -366,6 +1167,43 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 				*node.Lower,
 				*node.Upper)
 		}
+	case *parser.ContinentMatch:
+		continents := node.Continents
+		if node.Continent != nil {
+			continents = []*parser.Continent{node.Continent}
+		}
+		remote, src, dst := f.country("country"), f.country("src country"), f.country("dst country")
+		(*node).EvalResult, (*node).EvalResultSrc, (*node).EvalResultDst = false, false, false
+		for _, continent := range continents {
+			(*node).EvalResult = node.EvalResult || continent.Contains(remote)
+			(*node).EvalResultSrc = node.EvalResultSrc || continent.Contains(src)
+			(*node).EvalResultDst = node.EvalResultDst || continent.Contains(dst)
+		}
+	case *parser.CountryMatch:
+		countries := node.Countries
+		if node.Country != nil {
+			countries = []*parser.CountryCode{node.Country}
+		}
+		remote, src, dst := f.country("country"), f.country("src country"), f.country("dst country")
+		(*node).EvalResult, (*node).EvalResultSrc, (*node).EvalResultDst = false, false, false
+		for _, country := range countries {
+			(*node).EvalResult = node.EvalResult || country.Contains(remote)
+			(*node).EvalResultSrc = node.EvalResultSrc || country.Contains(src)
+			(*node).EvalResultDst = node.EvalResultDst || country.Contains(dst)
+		}
+	case *parser.MacMatch:
+		switch {
+		case node.MacClass != nil && *node.MacClass == "broadcast":
+			(*node).EvalResultSrc = f.flowmsg.SrcMac == 0xffffffffffff
+			(*node).EvalResultDst = f.flowmsg.DstMac == 0xffffffffffff
+		case node.MacClass != nil && *node.MacClass == "multicast":
+			// the group bit is the lowest bit of the first octet
+			(*node).EvalResultSrc = f.flowmsg.SrcMac&1 == 1
+			(*node).EvalResultDst = f.flowmsg.DstMac&1 == 1
+		case node.Mac != nil:
+			(*node).EvalResultSrc = matchMac(f.flowmsg.SrcMac, *node.Mac)
+			(*node).EvalResultDst = matchMac(f.flowmsg.DstMac, *node.Mac)
+		}
 	case *parser.MedRangeMatch:
 		(*node).EvalResult, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.Med))
 		if err != nil {
@@ -373,6 +1211,51 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 				*node.Lower,
 				*node.Upper)
 		}
+	case *parser.MplsMatch:
+		labels, ttls := mplsStack(f.flowmsg)
+		if node.Present {
+			(*node).EvalResult = len(labels) > 0
+			break
+		}
+		if node.Depth != nil {
+			depth := uint64(len(labels))
+			if len(f.flowmsg.MplsLabel) == 0 {
+				depth = uint64(f.flowmsg.MplsCount)
+			}
+			(*node).EvalResult, err = processNumericRange(node.Depth.NumericRange, depth)
+			if err != nil {
+				return fmt.Errorf("Bad mpls depth range, lower %d > upper %d",
+					*node.Depth.Lower,
+					*node.Depth.Upper)
+			}
+			break
+		}
+		var field string
+		var numericRange parser.NumericRange
+		var values []uint32
+		if node.Label != nil {
+			field, numericRange, values = "label", node.Label.NumericRange, labels
+		} else {
+			field, numericRange, values = "ttl", node.Ttl.NumericRange, ttls
+		}
+		if numericRange.Lower != nil && uint64(*numericRange.Lower) > uint64(*numericRange.Upper) {
+			return fmt.Errorf("Bad mpls %s range, lower %d > upper %d",
+				field,
+				*numericRange.Lower,
+				*numericRange.Upper)
+		}
+		if len(values) > 0 && node.Position != nil {
+			if *node.Position == "top" {
+				values = values[:1]
+			} else {
+				values = values[len(values)-1:]
+			}
+		}
+		(*node).EvalResult = false
+		for _, value := range values {
+			match, _ := processNumericRange(numericRange, uint64(value))
+			(*node).EvalResult = node.EvalResult || match
+		}
 	case *parser.NetsizeRangeMatch:
 		(*node).EvalResultSrc, _ = processNumericRange(node.NumericRange, uint64(f.flowmsg.SrcNet))
 		(*node).EvalResultDst, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.DstNet))
@@ -382,32 +1265,49 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 				*node.Upper)
 		}
 	case *parser.NextHopMatch:
-		(*node).EvalResult = net.IP(f.flowmsg.NextHop).Equal(*node.Address)
+		(*node).EvalResult = matchAddressPrefixes(f.flowmsg.NextHop, append(node.Addresses, node.Address)...)
 	case *parser.NextHopAsnMatch:
 		(*node).EvalResult = f.flowmsg.NextHopAs == *node.Asn
 	case *parser.NormalizedMatch:
 		(*node).EvalResult = f.flowmsg.Normalized == 1
 	case *parser.PacketRangeMatch:
-		(*node).EvalResult, err = processNumericRange(node.NumericRange, f.flowmsg.Packets)
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, f.scale(node.ScaledRange, f.flowmsg.Packets))
 		if err != nil {
 			return fmt.Errorf("Bad packet count range, lower %d > upper %d",
 				*node.Lower,
 				*node.Upper)
 		}
+	case *parser.PortMatch:
+		if node.Port != nil {
+			(*node).EvalResultSrc = node.Port.EvalResultSrc
+			(*node).EvalResultDst = node.Port.EvalResultDst
+			break
+		}
+		(*node).EvalResultSrc, (*node).EvalResultDst = false, false
+		for _, port := range node.Ports {
+			(*node).EvalResultSrc = node.EvalResultSrc || port.EvalResultSrc
+			(*node).EvalResultDst = node.EvalResultDst || port.EvalResultDst
+		}
 	case *parser.PortRangeMatch:
-		(*node).EvalResultSrc, _ = processNumericRange(node.NumericRange, uint64(f.flowmsg.SrcPort))
-		(*node).EvalResultDst, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.DstPort))
-		if err != nil { // errs from above calls will be the same anyways
-			return fmt.Errorf("Bad port range, lower %d > upper %d",
-				*node.Lower,
-				*node.Upper)
+		switch {
+		case node.ServiceKey != nil:
+			(*node).EvalResultSrc = f.flowmsg.SrcPort == uint32(*node.ServiceKey)
+			(*node).EvalResultDst = f.flowmsg.DstPort == uint32(*node.ServiceKey)
+		case node.Range != nil:
+			(*node).EvalResultSrc, _ = processNumericRange(*node.Range, uint64(f.flowmsg.SrcPort))
+			(*node).EvalResultDst, err = processNumericRange(*node.Range, uint64(f.flowmsg.DstPort))
+			if err != nil { // errs from above calls will be the same anyways
+				return fmt.Errorf("Bad port range, lower %d > upper %d",
+					*node.Range.Lower,
+					*node.Range.Upper)
+			}
 		}
 	case *parser.PpsRangeMatch:
 		duration := f.flowmsg.TimeFlowEnd - f.flowmsg.TimeFlowStart
 		if duration == 0 {
 			duration += 1
 		}
-		pps := f.flowmsg.Packets / duration
+		pps := f.scale(node.ScaledRange, f.flowmsg.Packets) / duration
 		(*node).EvalResult, err = processNumericRange(node.NumericRange, pps)
 		if err != nil {
 			return fmt.Errorf("Bad range: %v.", err)
@@ -440,16 +1340,17 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 		case node.ProtoKey != nil:
 			(*node).EvalResult = f.flowmsg.Proto == uint32(*node.ProtoKey)
 		}
-	case *parser.RemoteCountryMatch:
-		(*node).EvalResult = strings.Contains(f.flowmsg.RemoteCountry, strings.ToUpper(string(*node.CountryCode)))
 	case *parser.RouterMatch:
-		(*node).EvalResult = net.IP(f.flowmsg.SamplerAddress).Equal(*node.Address)
+		(*node).EvalResult = matchAddressPrefixes(f.flowmsg.SamplerAddress, append(node.Addresses, node.Address)...)
 	case *parser.RpkiMatch:
 		if node.RpkiKey == nil {
 			(*node).EvalResult = false
 			break
 		}
-		(*node).EvalResult = f.flowmsg.ValidationStatus == pb.EnrichedFlow_ValidationStatusType(*node.RpkiKey)
+		status := pb.EnrichedFlow_ValidationStatusType(*node.RpkiKey)
+		(*node).EvalResult = f.rpki("rpki") == status
+		(*node).EvalResultSrc = f.rpki("src rpki") == status
+		(*node).EvalResultDst = f.rpki("dst rpki") == status
 	case *parser.SamplingRateRangeMatch:
 		(*node).EvalResult, err = processNumericRange(node.NumericRange, f.flowmsg.SamplingRate)
 		if err != nil {
@@ -459,33 +1360,138 @@ func (f *Filter) Visit(n parser.Node, next func() error) error {
 		}
 	case *parser.Statement:
 		switch {
+		case node.Comparison != nil:
+			(*node).EvalResult, (*node).EvalUnknown = node.Comparison.EvalResult, node.Comparison.EvalUnknown
 		case node.DirectionalMatch != nil:
-			(*node).EvalResult = node.DirectionalMatch.EvalResult
+			(*node).EvalResult, (*node).EvalUnknown = node.DirectionalMatch.EvalResult, node.DirectionalMatch.EvalUnknown
 		case node.RegularMatch != nil:
-			(*node).EvalResult = node.RegularMatch.EvalResult
+			(*node).EvalResult, (*node).EvalUnknown = node.RegularMatch.EvalResult, node.RegularMatch.EvalUnknown
 		case node.SubExpression != nil:
-			(*node).EvalResult = node.SubExpression.EvalResult
+			(*node).EvalResult, (*node).EvalUnknown = node.SubExpression.EvalResult, node.SubExpression.EvalUnknown
 		}
-		if node.Negated != nil && *node.Negated == true {
+		if node.Negated != nil && *node.Negated == true { // unknown stays unknown
 			(*node).EvalResult = !(*node).EvalResult
 		}
+	case *parser.SequenceNumRangeMatch:
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.SequenceNum))
+		if err != nil {
+			return fmt.Errorf("Bad sequence range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
 	case *parser.StatusMatch:
 		switch {
+		case node.StatusClass != nil:
+			(*node).EvalResult = f.flowmsg.ForwardingStatus>>6 == uint32(*node.StatusClass)
 		case node.Status != nil:
-			(*node).EvalResult = f.flowmsg.ForwardingStatus == uint32(*node.Status)
+			(*node).EvalResult = node.Status.EvalResult
+		default:
+			(*node).EvalResult = false
+			for _, status := range node.Statuses {
+				(*node).EvalResult = node.EvalResult || status.EvalResult
+			}
+		}
+	case *parser.StatusRangeMatch:
+		switch {
+		case node.Lower != nil:
+			if *node.Lower > *node.Upper {
+				return fmt.Errorf("Bad status range, lower %d > upper %d",
+					*node.Lower,
+					*node.Upper)
+			}
+			(*node).EvalResult = uint32(*node.Lower) <= f.flowmsg.ForwardingStatus && f.flowmsg.ForwardingStatus <= uint32(*node.Upper)
 		case node.StatusKey != nil:
-			(*node).EvalResult = f.flowmsg.ForwardingStatus&uint32(*node.StatusKey) == uint32(*node.StatusKey)
+			(*node).EvalResult = f.flowmsg.ForwardingStatus == uint32(*node.StatusKey)
 		}
 	case *parser.TcpFlagsMatch:
-		if f.flowmsg.Proto != 6 {
+		if f.flowmsg.Proto != 6 && !f.TcpFlagsAnyProto {
 			(*node).EvalResult = false
 			break
 		}
+		var mask uint32
 		switch {
 		case node.TcpFlags != nil:
-			(*node).EvalResult = f.flowmsg.TcpFlags == uint32(*node.TcpFlags)
+			mask = uint32(*node.TcpFlags)
 		case node.TcpFlagsKey != nil:
-			(*node).EvalResult = f.flowmsg.TcpFlags&uint32(*node.TcpFlagsKey) == uint32(*node.TcpFlagsKey)
+			mask = uint32(*node.TcpFlagsKey)
+		default:
+			for _, key := range node.TcpFlagsKeys {
+				mask |= uint32(*key)
+			}
+		}
+		flags := f.flowmsg.TcpFlags
+		var quantifier string
+		if node.Quantifier != nil {
+			quantifier = string(*node.Quantifier)
+		}
+		switch quantifier {
+		case "any":
+			(*node).EvalResult = flags&mask != 0
+		case "all":
+			(*node).EvalResult = flags&mask == mask
+		case "none":
+			(*node).EvalResult = flags&mask == 0
+		case "only":
+			(*node).EvalResult = flags == mask
+		default:
+			switch {
+			case node.TcpFlags != nil:
+				(*node).EvalResult = flags == mask
+			case node.TcpFlagsKey != nil:
+				(*node).EvalResult = flags&mask == mask
+			default: // a set matches if any of its flags match
+				(*node).EvalResult = false
+				for _, key := range node.TcpFlagsKeys {
+					(*node).EvalResult = node.EvalResult || flags&uint32(*key) == uint32(*key)
+				}
+			}
+		}
+	case *parser.TimeMatch:
+		var timestamp uint64
+		switch {
+		case node.Field == nil || *node.Field == "start":
+			timestamp = f.flowmsg.TimeFlowStart
+		case *node.Field == "end":
+			timestamp = f.flowmsg.TimeFlowEnd
+		case *node.Field == "received":
+			timestamp = f.flowmsg.TimeReceived
+		}
+		loc := time.UTC
+		if node.Location != nil {
+			loc = node.Location.Location
+		} else if f.Location != nil {
+			loc = f.Location
+		}
+		t := time.Unix(int64(timestamp), 0).In(loc)
+		switch {
+		case node.TimeOfDay != nil:
+			(*node).EvalResult = node.TimeOfDay.Contains(parser.TimeOfDay(t.Hour()*3600 + t.Minute()*60 + t.Second()))
+		case node.Weekdays != nil:
+			(*node).EvalResult = node.Weekdays.Contains(t.Weekday())
+		case node.After != nil:
+			(*node).EvalResult = t.After(node.After.In(loc))
+		case node.Before != nil:
+			(*node).EvalResult = t.Before(node.Before.In(loc))
+		case node.Within != nil:
+			(*node).EvalResult = f.now().Sub(t) <= time.Duration(*node.Within)
+		}
+		// flows without the timestamp never match
+		(*node).EvalResult = node.EvalResult && timestamp != 0
+	case *parser.TtlRangeMatch:
+		(*node).EvalResult, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.IpTtl))
+		if err != nil {
+			return fmt.Errorf("Bad ttl range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
+		}
+	case *parser.VlanRangeMatch:
+		(*node).EvalResult, _ = processNumericRange(node.NumericRange, uint64(f.flowmsg.VlanId))
+		(*node).EvalResultSrc, _ = processNumericRange(node.NumericRange, uint64(f.flowmsg.SrcVlan))
+		(*node).EvalResultDst, err = processNumericRange(node.NumericRange, uint64(f.flowmsg.DstVlan))
+		if err != nil {
+			return fmt.Errorf("Bad vlan range, lower %d > upper %d",
+				*node.Lower,
+				*node.Upper)
 		}
 	case *parser.VrfRangeMatch:
 		(*node).EvalResultSrc, _ = processNumericRange(node.NumericRange, uint64(f.flowmsg.IngressVrfId))
@@ -2,8 +2,9 @@ package visitors
 
 import (
 	// "fmt"
-	// "net"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/BelWue/flowfilter/parser"
 	"github.com/BelWue/flowpipeline/pb"
@@ -15,22 +16,26 @@ var (
 		// directional fields
 		SrcAddr:      []byte{10, 0, 0, 200},
 		DstAddr:      []byte{32, 1, 7, 192, 0, 0, 2, 84, 0, 0, 0, 0, 0, 0, 0, 6},
-		SrcPort:      0,           // uint32
-		DstPort:      1024,        // uint32
-		SrcAs:        553,         // uint32
-		DstAs:        12345,       // uint32
-		InIf:         1,           // uint32
-		OutIf:        2,           // uint32
-		SrcIfName:    "Hu0/1/1/4", // string // TODO: check how to use plain goflow
-		SrcIfDesc:    "some IX",   // string // TODO: check how to use plain goflow
-		SrcIfSpeed:   100000,      // uint32 // TODO: check how to use plain goflow
-		DstIfName:    "Te1/1/1/1", // string // TODO: check how to use plain goflow
-		DstIfDesc:    "customer",  // string // TODO: check how to use plain goflow
-		DstIfSpeed:   10000,       // uint32 // TODO: check how to use plain goflow
-		SrcNet:       24,          // uint32
-		DstNet:       11,          // uint32
-		IngressVrfId: 1,           // uint32
-		EgressVrfId:  2,           // uint32
+		SrcPort:      0,              // uint32
+		DstPort:      1024,           // uint32
+		SrcAs:        553,            // uint32
+		DstAs:        12345,          // uint32
+		InIf:         1,              // uint32
+		OutIf:        2,              // uint32
+		SrcIfName:    "Hu0/1/1/4",    // string // TODO: check how to use plain goflow
+		SrcIfDesc:    "some IX",      // string // TODO: check how to use plain goflow
+		SrcIfSpeed:   100000,         // uint32 // TODO: check how to use plain goflow
+		DstIfName:    "Te1/1/1/1",    // string // TODO: check how to use plain goflow
+		DstIfDesc:    "customer",     // string // TODO: check how to use plain goflow
+		DstIfSpeed:   10000,          // uint32 // TODO: check how to use plain goflow
+		SrcNet:       24,             // uint32
+		DstNet:       11,             // uint32
+		IngressVrfId: 1,              // uint32
+		EgressVrfId:  2,              // uint32
+		SrcMac:       0x5c4b3a211b00, // uint64, 00:1b:21:3a:4b:5c
+		DstMac:       0xfb00005e0001, // uint64, 01:00:5e:00:00:fb
+		SrcVlan:      100,            // uint32
+		DstVlan:      200,            // uint32
 
 		// complex fields
 		SamplerAddress:   []byte{10, 0, 0, 1},
@@ -43,6 +48,8 @@ var (
 		TimeFlowStart:    10000,      // uint64
 		TimeFlowEnd:      10250,      // uint64
 		RemoteCountry:    "DE",       // string // TODO: check how to use plain goflow
+		SrcCountry:       "DE",       // string
+		DstCountry:       "US",       // string
 		Etype:            0x0800,     // uint32
 		Proto:            1,          // uint32
 		ForwardingStatus: 0b01000010, // uint32
@@ -56,24 +63,27 @@ var (
 		LocalPref:        100,        // uint32
 		NextHopAs:        553,        // uint32
 		ValidationStatus: 2,          // uint32
+		HasMpls:          true,       // bool
+		MplsCount:        2,          // uint32
+		Mpls_1Label:      24001,      // uint32
+		Mpls_1Ttl:        254,        // uint32
+		Mpls_2Label:      16005,      // uint32
+		Mpls_2Ttl:        1,          // uint32
+		IpTtl:            64,         // uint32
+		IpFlags:          0b001,      // uint32
+		Ipv6FlowLabel:    0xabcde,    // uint32
+		FragmentId:       4711,       // uint32
 
-		// TODO: set but kinda useless for a filter language?
-		// Type:		// int32 // 0, sFlow 1, NFv5 2, NFv9 3, IPFIX 4
-		// TimeReceived:	// uint64
-		// SequenceNum:		// uint32
+		// export metadata
+		Type:         pb.EnrichedFlow_NETFLOW_V9,
+		TimeReceived: 10300, // uint64
+		SequenceNum:  1337,  // uint32
 
 		// stuff thats unset
-		// IPTTL:               // uint32
-		// SrcMac:		// uint64
-		// DstMac:		// uint64
-		// SrcVlan:		// uint32
-		// DstVlan:		// uint32
 		// VlanId:		// uint32
 		// IcmpType:		// uint32
 		// IcmpCode:		// uint32
-		// IPv6FlowLabel:	// uint32
-		// FragmentId:		// uint32
-		// FragmentOffset:	// uint32
+		// FragmentOffset:	// uint32, 0 with IpFlags above means first fragment
 		// BiFlowDirection:	// uint32
 		// NextHopAs:		// uint32
 		// HasEncap:		// bool
@@ -86,12 +96,6 @@ var (
 		// IPv6FlowLabelEncap:	// uint32
 		// FragmentIdEncap:	// uint32
 		// FragmentOffsetEncap:	// uint32
-		// HasMPLS:		// bool
-		// MPLSCount:		// uint32
-		// MPLS1TTL:		// uint32
-		// MPLS1Label:		// uint32
-		// MPLS2TTL:		// uint32
-		// MPLS2Label:		// uint32
 		// MPLS3TTL:		// uint32
 		// MPLS3Label:		// uint32
 		// MPLSLastTTL:		// uint32
@@ -122,6 +126,9 @@ func TestAccept(t *testing.T) {
 		`iface desc 'cust'`,
 		`iface speed >0`,
 		`src iface speed 10-1000000`,
+		`iface 1 on router 10.0.0.1`,
+		`dst iface 10.0.0.1:2`,
+		`iface {10.0.0.2:1, 2}`,
 		// `port` `<range>`
 		`port 0`,
 		`port 0-100`,
@@ -133,6 +140,9 @@ func TestAccept(t *testing.T) {
 		`dst port 1024`,
 		`port >1`,
 		`port <1`,
+		`port {0, ssh}`,
+		`dst port {ssh, 1000-2000}`,
+		`not port {http, https}`,
 		// `asn` `<range>`
 		`asn 553`,
 		`asn <65000`,
@@ -142,10 +152,35 @@ func TestAccept(t *testing.T) {
 		// `vrf` `<range>`
 		`vrf 1`,
 		`dst vrf >1`,
+		// `mac` `<mac>|<mac prefix>|broadcast|multicast`
+		`mac 00:1b:21:3a:4b:5c`,
+		`src mac 00-1b-21-3a-4b-5c`,
+		`src mac 001b.213a.4b5c`,
+		`src mac 00:1b:21:*`,
+		`dst mac 01-00-5e-*`,
+		`mac multicast`,
+		`not mac broadcast`,
+		`not src mac multicast`,
+		// `vlan` `<range>`
+		`vlan 100`,
+		`src vlan <200`,
+		`dst vlan 200-299`,
 		// `router` `<address>`
 		`router 10.0.0.1`,
+		`router 10.0.0.0/24`,
+		`router {10.0.0.2, 10.0.0.1}`,
+		`router {2001:db8::/32, 10.0.0.0/8}`,
 		// `nexthop` `<address>`
 		`nexthop 10.11.0.1`,
+		`nexthop 10.11.0.0/16`,
+		`nexthop {10.11.0.1, 10.11.0.2}`,
+		// `type` `<int>|<flowtype>`
+		`type nfv9`,
+		`type 3`,
+		`not type sflow`,
+		// `sequence` `<range>`
+		`sequence 1337`,
+		`sequence 1000-2000`,
 		// `bytes` `<range>`
 		`bytes 20490000`,
 		`bytes >1000`,
@@ -164,8 +199,13 @@ func TestAccept(t *testing.T) {
 		`duration 250`,
 		// `dscp` `<int>|dscp
 		`dscp default`,
+		`dscp cs0`,
+		`dscp default-cs1`,
+		`not dscp af1x`,
 		// `ecn` `<int>|ecn
 		`ecn ce`,
+		`ecn capable`,
+		`not ecn notect`,
 		// `etype` `<int>|etype
 		`etype 0x0800`,
 		`etype 2048`,
@@ -174,8 +214,14 @@ func TestAccept(t *testing.T) {
 		`proto 1`,
 		`proto icmp`,
 		`not proto 7`,
+		`not proto gre`,
 		// `status` `<int>|status
 		`status forwarded`,
+		`status class forwarded`,
+		`status reason notfragmented`,
+		`status {fragmented, notfragmented}`,
+		`status 64-127`,
+		`not status dropped`,
 		// `tcpflags` `<int>|tcpflag
 		`not tcpflags ack`,
 		// `iptos` <range>
@@ -186,11 +232,28 @@ func TestAccept(t *testing.T) {
 		// `cid` `<range>`
 		`cid 123`,
 		`src cid 1-100`,
+		// `local`, `remote`, `ingress`, `egress`
+		`remote asn 553`,
+		`local asn 12345`,
+		`remote address 10.0.0.0/24`,
+		`local port 1024`,
+		`ingress iface 1`,
+		`egress interface 2`,
+		`ingress vrf 1`,
+		`egress vrf 2`,
 		`not cid 1283`,
 		// `icmp type` `<int>`
 		`icmp type 4`,
 		// `icmp code` `<int>`
 		`icmp code 0`,
+		`icmp type {3, 4}`,
+		`icmp type 3-5`,
+		`icmp code <1`,
+		`icmp source-quench`,
+		`icmp type source-quench`,
+		`icmp {echo-request, source-quench}`,
+		`not icmp echo-request`,
+		`not icmpv6 type 4`,
 		// `bps` `<range>`
 		`bps 655680`,
 		`bps >100`,
@@ -199,10 +262,73 @@ func TestAccept(t *testing.T) {
 		// `passes-through` `<range>`
 		`passes-through 553`,
 		`passes-through 553 554 555`,
+		// `aspath`
+		`aspath ~ "^553 554 555$"`,
+		`aspath ~ "^553 (174|554) .* 555$"`,
+		`aspath ~ '_554_'`,
+		`aspath ~ "^553 .{2}$"`,
+		`aspath length 3`,
+		`aspath origin 555`,
+		`aspath first 553`,
+		`not aspath prepended`,
+		`not aspath contains-private`,
 		`med <200`,
 		`localpref >99`,
 		`nexthopasn 553`,
 		`rpki notfound`,
+		`mpls present`,
+		`mpls depth 2`,
+		`mpls label 16000-16999`,
+		`mpls top label 24001`,
+		`mpls bottom label 16005`,
+		`mpls ttl <2`,
+		`mpls top ttl >253`,
+		`ttl 64`,
+		`ttl 60-70`,
+		`flowlabel 0xabcde`,
+		`fragment-id 4711`,
+		`fragment-offset 0`,
+		`fragment`,
+		`first-fragment`,
+		`not non-first-fragment`,
+		// comparisons
+		`src asn != dst asn`,
+		`src port < dst port`,
+		`src cid != dst cid`,
+		`dst cid == cid`,
+		`inif < outif`,
+		`InIf <= OutIf`,
+		`nexthopasn == src asn`,
+		`bytes >= packets`,
+		`router != nexthop`,
+		`src mac != dst mac`,
+		`not InIf == OutIf`,
+		`src port <1000 and src asn != dst asn`,
+		// arithmetic
+		`bytes / packets > 1400`,
+		`bytes * samplingrate > 600M`,
+		`(timeflowend - timeflowstart) > 200`,
+		`duration == 250`,
+		`bytes * 8 / duration == 655680`,
+		`packets + 1 * 2 == 402`,
+		`(packets + 1) * 2 == 802`,
+		`timeflowstart - timeflowend == 0`,
+		`bytes * 1T * 1T == 0xffffffffffffffff`,
+		`bytes + 0xffffffffffffffff == 0xffffffffffffffff`,
+		`not bytes / 0 == 0`,
+		`bytes >20M`,
+		`bytes <20Mi`,
+		// countries
+		`src country de`,
+		`dst country US`,
+		`either country {fr, us}`,
+		`country eu`,
+		`src country eu`,
+		`not dst country eu`,
+		`continent europe`,
+		`dst continent north-america`,
+		`continent {asia, europe}`,
+		`both continent {europe, north-america}`,
 	}
 
 	for _, test := range tests {
@@ -237,6 +363,9 @@ func TestReject(t *testing.T) {
 		`iface desc 'king'`,
 		`iface speed <0`,
 		`src iface speed 10-10`,
+		`iface 1 on router 10.0.0.2`,
+		`src iface 10.0.0.1:2`,
+		`iface {10.0.0.2:1, 10.0.0.2:2, 3}`,
 		// `port` `<range>`
 		`port 1`,
 		`port 1-100`,
@@ -246,6 +375,9 @@ func TestReject(t *testing.T) {
 		`src port 1`,
 		`dst port 1023`,
 		`port <0`,
+		`port {ssh, https}`,
+		`src port {1, 1024}`,
+		`dst port ssh`,
 		// `asn` `<range>`
 		`asn 554`,
 		`asn >65000`,
@@ -255,10 +387,29 @@ func TestReject(t *testing.T) {
 		// `vrf` `<range>`
 		`vrf 0`,
 		`dst vrf <1`,
+		// `mac` `<mac>|<mac prefix>|broadcast|multicast`
+		`mac 00:1b:21:3a:4b:5d`,
+		`dst mac 00:1b:21:3a:4b:5c`,
+		`mac 5c:4b:3a:21:1b:00`,
+		`src mac 00:1b:22:*`,
+		`mac broadcast`,
+		`src mac multicast`,
+		// `vlan` `<range>`
+		`vlan 300`,
+		`src vlan 200`,
+		`dst vlan <200`,
 		// `router` `<address>`
 		`router 10.0.0.2`,
+		`router 10.0.1.0/24`,
+		`router {10.0.0.2, 10.0.0.3}`,
 		// `nexthop` `<address>`
 		`nexthop 10.11.0.2`,
+		`nexthop 10.12.0.0/16`,
+		// `type` `<int>|<flowtype>`
+		`type ipfix`,
+		`type {nfv5, sflow}`,
+		// `sequence` `<range>`
+		`sequence >1337`,
 		// `bytes` `<range>`
 		`bytes 2049`,
 		`bytes <1000`,
@@ -284,10 +435,26 @@ func TestReject(t *testing.T) {
 		`proto 2`,
 		`proto tcp`,
 		`not proto 1`,
+		`proto icmpv6`,
+		`proto ipv4`,
 		// `status` `<int>|status
 		`status acldeny`,
+		`status dropped`,
+		`status fragmented`,
+		`status reason 128-143`,
+		`status {wred, policer}`,
+		`status class unknown`,
 		// `tcpflags` `<int>|tcpflag
 		`tcpflags ack`,
+		`tcpflags any {syn, rst}`,
+		`tcpflags none {fin}`,
+		// `dscp` `<int>|dscp
+		`dscp ef`,
+		`dscp af11-af43`,
+		`dscp af1x`,
+		// `ecn` `<int>|ecn
+		`ecn notect`,
+		`ecn ect0`,
 		// `dsfield|iptos` <int>|dsstring
 		// `samplingrate` `<range>`
 		`samplingrate 31`,
@@ -296,10 +463,27 @@ func TestReject(t *testing.T) {
 		`cid 1234`,
 		`not cid 123`,
 		`not dst cid 123`,
+		// `local`, `remote`, `ingress`, `egress`
+		`remote asn 12345`,
+		`local address 10.0.0.200`,
+		`remote port 1024`,
+		`ingress iface 2`,
+		`egress vrf 1`,
+		// `both`, `either`
+		`both asn 553`,
+		`either asn 554`,
+		`both mac multicast`,
+		`both vlan 100`,
 		// `icmp type` `<int>`
 		`icmp type 2`,
 		// `icmp code` `<int>`
 		`icmp code 1`,
+		`icmp type {0, 8}`,
+		`icmp echo-request`,
+		`icmp type echo-request`,
+		`icmp dest-unreach port-unreach`,
+		`icmp port-unreach`,
+		`icmpv6 type 4`,
 		// `bps` `<range>`
 		`bps 655681`,
 		`bps <100`,
@@ -309,10 +493,49 @@ func TestReject(t *testing.T) {
 		`passes-through 666`,
 		`passes-through 555 554`,
 		`passes-through 553 554 555 556`,
+		// `aspath`
+		`aspath ~ "^554"`,
+		`aspath ~ "55"`,
+		`aspath ~ "^553 .* 554$"`,
+		`aspath length >3`,
+		`aspath origin 553`,
+		`aspath first 555`,
 		`med >200`,
 		`localpref <99`,
 		`nexthopasn 554`,
 		`rpki valid`,
+		`not mpls present`,
+		`mpls depth >2`,
+		`mpls label 100-1000`,
+		`mpls top label 16005`,
+		`mpls bottom label 24001`,
+		`mpls bottom ttl >1`,
+		`encap present`,
+		`encap proto icmp`,
+		`ttl <64`,
+		`flowlabel 0`,
+		`fragment-id >4711`,
+		`fragment-offset >0`,
+		`non-first-fragment`,
+		`not fragment`,
+		`InIf == OutIf`,
+		`src asn == dst asn`,
+		`src port >= dst port`,
+		`src address == dst address`,
+		`router == nexthop`,
+		`src mac == dst mac`,
+		`bytes / packets < 1400`,
+		`bytes / 0 == 0`,
+		`bytes / 0 != 0`,
+		`bytes / (packets - packets) >= 0`,
+		`bytes >1G`,
+		`src country us`,
+		`dst country de`,
+		`country {fr, es}`,
+		`country us`, // remote country only
+		`continent north-america`,
+		`continent asia`,
+		`both continent europe`,
 	}
 
 	for _, test := range tests {
@@ -331,6 +554,615 @@ func TestReject(t *testing.T) {
 	}
 }
 
+func TestTcpFlagsAnyProto(t *testing.T) {
+	// The test flow is not TCP, but has the flags of a SYN-ACK.
+	tests := map[string]bool{
+		`tcpflags synack`:             true,
+		`tcpflags 0b010010`:           true,
+		`tcpflags {fin, syn}`:         true,
+		`tcpflags any {syn, rst}`:     true,
+		`tcpflags all {syn, ack}`:     true,
+		`tcpflags none {fin, rst}`:    true,
+		`tcpflags only synack`:        true,
+		`tcpflags only {syn, ack}`:    true,
+		`tcpflags finack`:             false,
+		`tcpflags ece`:                false,
+		`tcpflags any {fin, rst}`:     false,
+		`tcpflags all {syn, fin}`:     false,
+		`tcpflags none {ack, fin}`:    false,
+		`tcpflags only syn`:           false,
+		`tcpflags {fin, rst, finack}`: false,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{TcpFlagsAnyProto: true}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+}
+
+func TestIcmpFields(t *testing.T) {
+	// ICMPv6 flow with dedicated type and code fields, and a port which
+	// would decode to an echo request.
+	flowmsg := &pb.EnrichedFlow{
+		Proto:    58,
+		DstPort:  128 * 256,
+		IcmpType: 1,
+		IcmpCode: 4,
+	}
+	tests := map[string]bool{
+		`icmpv6 dest-unreach`:              true,
+		`icmpv6 port-unreach`:              true,
+		`icmpv6 dest-unreach port-unreach`: true,
+		`icmpv6 type 1 and icmpv6 code 4`:  true,
+		`icmpv6 echo-request`:              false,
+		`icmpv6 packet-too-big`:            false,
+		`icmpv6 admin-prohibited`:          false,
+		`icmp dest-unreach`:                false,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+}
+
+func TestMplsStack(t *testing.T) {
+	// Flow with the full label stack, which differs from the first three
+	// and last labels reported separately.
+	flowmsg := &pb.EnrichedFlow{
+		HasMpls:       true,
+		MplsCount:     3,
+		Mpls_1Label:   1,
+		MplsLastLabel: 3,
+		MplsLabel:     []uint32{16001, 16002, 16003, 16004, 24005},
+		MplsTtl:       []uint32{64, 64, 64, 64, 1},
+	}
+	tests := map[string]bool{
+		`mpls present`:            true,
+		`mpls depth 5`:            true,
+		`mpls label 16004`:        true,
+		`mpls top label 16001`:    true,
+		`mpls bottom label 24005`: true,
+		`mpls bottom ttl 1`:       true,
+		`mpls depth 3`:            false,
+		`mpls label 1`:            false,
+		`mpls bottom label 3`:     false,
+		`mpls top ttl 1`:          false,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+}
+
+func TestEncap(t *testing.T) {
+	// TCP over IPv6 over GRE over IPv4
+	flowmsg := &pb.EnrichedFlow{
+		Etype: 0x0800,
+		Proto: 47,
+		LayerStack: []pb.EnrichedFlow_LayerStack{
+			pb.EnrichedFlow_Ethernet,
+			pb.EnrichedFlow_IPv4,
+			pb.EnrichedFlow_GRE,
+			pb.EnrichedFlow_IPv6,
+			pb.EnrichedFlow_IPv6HeaderRouting,
+			pb.EnrichedFlow_TCP,
+		},
+	}
+	tests := map[string]bool{
+		`encap present`:               true,
+		`encap proto tcp`:             true,
+		`encap etype ipv6`:            true,
+		`proto gre and encap proto 6`: true,
+		`encap proto gre`:             false,
+		`encap etype ipv4`:            false,
+		`proto encap`:                 false,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+}
+
+func TestAge(t *testing.T) {
+	// The test flow was received at 10300.
+	now := func() time.Time { return time.Unix(10360, 0) }
+	tests := map[string]bool{
+		`age 60`:     true,
+		`age <61`:    true,
+		`age 0-60`:   true,
+		`age >60`:    false,
+		`age 61-120`: false,
+		`age 1m`:     true,
+		`age <2m`:    true,
+		`age 30s-1m`: true,
+		`age >1m`:    false,
+		`age 1h-1d`:  false,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{Now: now}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// flows without a time of reception never match
+	expr, _ := parser.Parse(`age >0`)
+	result, err := (&Filter{Now: now}).CheckFlow(expr, &pb.EnrichedFlow{})
+	if err != nil || result {
+		t.Errorf("Filter `age >0` matched a flow without time of reception.\n")
+	}
+}
+
+func TestScaled(t *testing.T) {
+	flowmsg := &pb.EnrichedFlow{
+		Bytes:         1000,
+		Packets:       10,
+		SamplingRate:  100,
+		TimeFlowStart: 10000,
+		TimeFlowEnd:   10010,
+	}
+	tests := map[string]bool{
+		`bytes 1000`:          true,
+		`bytes scaled 100k`:   true,
+		`bytes scaled 1000`:   false,
+		`packets scaled 1000`: true,
+		`bps scaled 80k`:      true,
+		`pps scaled 100`:      true,
+		`pps 1`:               true,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// the filter option scales all matches
+	expr, _ := parser.Parse(`bytes 100k`)
+	if result, err := (&Filter{Scaled: true}).CheckFlow(expr, flowmsg); err != nil || !result {
+		t.Errorf("Filter `bytes 100k` does not match the test flow when scaling.\n")
+	}
+
+	// normalized flows and flows with unknown sampling rate are not scaled
+	expr, _ = parser.Parse(`bytes scaled 1000`)
+	normalized := &pb.EnrichedFlow{Bytes: 1000, SamplingRate: 100, Normalized: 1}
+	if result, err := (&Filter{}).CheckFlow(expr, normalized); err != nil || !result {
+		t.Errorf("Filter `bytes scaled 1000` scaled a normalized flow.\n")
+	}
+	unknown := &pb.EnrichedFlow{Bytes: 1000}
+	if result, err := (&Filter{}).CheckFlow(expr, unknown); err != nil || !result {
+		t.Errorf("Filter `bytes scaled 1000` scaled a flow without sampling rate.\n")
+	}
+
+	// scaled rates saturate instead of overflowing
+	expr, _ = parser.Parse(`bps scaled >1000`)
+	huge := &pb.EnrichedFlow{Bytes: 1 << 40, SamplingRate: 1 << 21, TimeFlowStart: 10000, TimeFlowEnd: 10001}
+	if result, err := (&Filter{}).CheckFlow(expr, huge); err != nil || !result {
+		t.Errorf("Filter `bps scaled >1000` overflowed on a huge flow.\n")
+	}
+}
+
+func TestTime(t *testing.T) {
+	// Monday, 2026-10-05, the flow started 07:30 UTC and ended five minutes
+	// later, it was received a minute after that.
+	flowmsg := &pb.EnrichedFlow{
+		TimeFlowStart: 1791185400,
+		TimeFlowEnd:   1791185700,
+		TimeReceived:  1791185760,
+	}
+	now := func() time.Time { return time.Unix(1791186000, 0) }
+	tests := map[string]bool{
+		`time 07:00-08:00`:                                true,
+		`time 08:00-18:00`:                                false,
+		`time 08:00-18:00 in "Europe/Berlin"`:             true,
+		`time 22:00-08:00`:                                true,
+		`time 07:30-07:35`:                                true,
+		`end time 07:30-07:35`:                            false,
+		`weekday mon-fri`:                                 true,
+		`weekday sat-mon`:                                 true,
+		`weekday tue`:                                     false,
+		`weekday sun in "Pacific/Honolulu"`:               true,
+		`start after 2026-10-01T00:00Z`:                   true,
+		`start after 2026-10-05T07:30Z`:                   false,
+		`start before 2026-10-05`:                         false,
+		`end after 2026-10-05T09:34+02:00`:                true,
+		`start after 2026-10-05T09:00 in "Europe/Berlin"`: true,
+		`start after 2026-10-05T09:00`:                    false,
+		`received within 5m`:                              true,
+		`received within 3m`:                              false,
+		`within 10m`:                                      true,
+		`start within 9m`:                                 false,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{Now: now}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// the filter's time zone applies to matches without their own
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, _ := parser.Parse(`time 08:00-18:00`)
+	if result, err := (&Filter{Location: berlin}).CheckFlow(expr, flowmsg); err != nil || !result {
+		t.Errorf("Filter `time 08:00-18:00` does not match the test flow in Europe/Berlin.\n")
+	}
+
+	// flows without timestamps never match
+	expr, _ = parser.Parse(`weekday mon-sun`)
+	if result, err := (&Filter{}).CheckFlow(expr, &pb.EnrichedFlow{}); err != nil || result {
+		t.Errorf("Filter `weekday mon-sun` matched a flow without timestamps.\n")
+	}
+}
+
+func TestThreeValued(t *testing.T) {
+	// a partially enriched flow
+	flowmsg := &pb.EnrichedFlow{
+		Proto:     6,
+		SrcAs:     553,
+		SrcIfName: "Hu0/0/0",
+		SrcCid:    10,
+	}
+	tests := map[string]bool{
+		`has src asn`:                       true,
+		`has dst asn`:                       false,
+		`exists country`:                    false,
+		`not has country`:                   true,
+		`src asn 553`:                       true,
+		`asn 553`:                           true,
+		`cid 10`:                            true,
+		`asn 554 or proto 6`:                true,
+		`country de and proto 17`:           false,
+		`src iface name "Hu0/0/0"`:          true,
+		`not (rpki valid and proto 17)`:     true,
+		`has src iface name and proto 6`:    true,
+		`bytes / packets > 1400 or proto 6`: true,
+	}
+	unknowns := []string{
+		`bytes / packets > 1400`, // no packets
+		`not (bytes / packets > 1400)`,
+		`not bytes / packets <= 1400`,
+		`country de`,
+		`not country de`,
+		`asn 554`,
+		`dst asn 0`,
+		`both asn 553`,
+		`not dst iface name "Hu"`,
+		`country de or proto 17`,
+		`not (rpki valid and proto 6)`,
+		`med 0`,
+	}
+
+	for _, matchUnknown := range []bool{false, true} {
+		filter := &Filter{ThreeValued: true, MatchUnknown: matchUnknown}
+		for test, expected := range tests {
+			expr, err := parser.Parse(test)
+			if err != nil {
+				t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+			}
+			result, err := filter.CheckFlow(expr, flowmsg)
+			if err != nil {
+				t.Error(err)
+			}
+			if result != expected {
+				t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+			}
+		}
+		for _, test := range unknowns {
+			expr, err := parser.Parse(test)
+			if err != nil {
+				t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+			}
+			result, err := filter.CheckFlow(expr, flowmsg)
+			if err != nil {
+				t.Error(err)
+			}
+			if result != matchUnknown {
+				t.Errorf("Filter `%s` returned %t for the test flow, but is unknown.\n", test, result)
+			}
+		}
+	}
+
+	// by default, missing fields are empty
+	expr, _ := parser.Parse(`not country de`)
+	if result, err := (&Filter{}).CheckFlow(expr, flowmsg); err != nil || !result {
+		t.Errorf("Filter `not country de` does not match the test flow.\n")
+	}
+}
+
+func TestPresenceFields(t *testing.T) {
+	for name := range parser.PresenceFields {
+		if _, ok := presenceFields[name]; !ok {
+			t.Errorf("Presence field %q has no getter.\n", name)
+		}
+	}
+}
+
+func TestAsPath(t *testing.T) {
+	flowmsg := &pb.EnrichedFlow{AsPath: []uint32{553, 553, 65000, 6830}}
+	tests := map[string]bool{
+		`aspath prepended`:             true,
+		`aspath contains-private`:      true,
+		`aspath ~ "^553+ 65000 6830$"`: true,
+		`aspath ~ "^553 . 6830$"`:      false,
+		`aspath origin 6830`:           true,
+		`aspath length 4`:              true,
+		`passes-through 553 553 65000`: true,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// flows without a path have no origin
+	expr, _ := parser.Parse(`aspath origin 0`)
+	result, err := (&Filter{}).CheckFlow(expr, &pb.EnrichedFlow{})
+	if err != nil || result {
+		t.Errorf("Filter `aspath origin 0` matched a flow without AS path.\n")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	flowmsg := &pb.EnrichedFlow{
+		SrcAddr: net.ParseIP("10.1.2.3").To4(),
+		SrcNet:  24,
+		DstAddr: net.ParseIP("2001:db8:1::1"),
+		DstNet:  48,
+	}
+	tests := map[string]bool{
+		`src prefix 10.1.2.0/24`:          true,
+		`src prefix 10.1.2.0/24 exact`:    true,
+		`src prefix 10.1.0.0/16`:          false,
+		`src prefix 10.1.0.0/16 orlonger`: true,
+		`src prefix 10.1.2.0/24 orlonger`: true,
+		`src prefix 10.1.2.0/24 longer`:   false,
+		`src prefix 10.1.0.0/16 longer`:   true,
+		`src prefix 10.1.0.0/16 upto /23`: false,
+		`src prefix 10.1.0.0/16 upto /24`: true,
+		`src prefix 10.1.3.0/24 orlonger`: false,
+		`src prefix 10.1.2.0/25 orlonger`: false, // routed prefix is shorter
+		`src prefix 10.1.7.7/16 orlonger`: true,  // host bits are ignored
+		`dst prefix 2001:db8::/32 longer`: true,
+		`dst prefix 10.0.0.0/8 orlonger`:  false,
+		`prefix 2001:db8:1::/48`:          true,
+		`both prefix 10.0.0.0/8 orlonger`: false,
+		`not dst prefix 2001:db8::/32`:    true,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+			continue
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// flows without netsize have no routed prefix
+	expr, _ := parser.Parse(`src prefix 10.0.0.0/8 orlonger`)
+	result, err := (&Filter{}).CheckFlow(expr, &pb.EnrichedFlow{SrcAddr: net.ParseIP("10.0.0.1").To4()})
+	if err != nil || result {
+		t.Errorf("Filter `src prefix 10.0.0.0/8 orlonger` matched a flow without netsize.\n")
+	}
+}
+
+func TestCustomer(t *testing.T) {
+	parser.Customers = parser.CustomerMap{
+		"Uni Stuttgart": {1000, 1001},
+		"HS-Esslingen":  {2000},
+		"HS-Aalen":      {2001},
+	}
+	t.Cleanup(func() { parser.Customers = nil })
+	flowmsg := &pb.EnrichedFlow{SrcCid: 1001, DstCid: 2001}
+	tests := map[string]bool{
+		`customer "Uni Stuttgart"`:     true,
+		`src customer "Uni Stuttgart"`: true,
+		`dst customer "Uni Stuttgart"`: false,
+		`dst customer ~ "^HS-"`:        true,
+		`both customer ~ "^HS-"`:       false,
+		`customer "HS-Esslingen"`:      false,
+		`not customer ~ "Esslingen$"`:  true,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+			continue
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// the flow wide customer matches too
+	expr, _ := parser.Parse(`customer "HS-Esslingen"`)
+	if result, _ := (&Filter{}).CheckFlow(expr, &pb.EnrichedFlow{Cid: 2000}); !result {
+		t.Errorf("Filter `customer \"HS-Esslingen\"` did not match the flow's cid.\n")
+	}
+}
+
+func TestLocalRemote(t *testing.T) {
+	// outgoing flows originate locally
+	flowmsg := &pb.EnrichedFlow{
+		FlowDirection: 1,
+		SrcAs:         553,
+		DstAs:         6830,
+		InIf:          1,
+		OutIf:         2,
+	}
+	tests := map[string]bool{
+		`local asn 553`:      true,
+		`remote asn 6830`:    true,
+		`ingress iface 1`:    true,
+		`egress iface 2`:     true,
+		`local asn 6830`:     false,
+		`remote asn 553`:     false,
+		`not remote asn 553`: true,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+}
+
+func TestCountry(t *testing.T) {
+	// an incoming flow from the US, enriched with its remote country only
+	flowmsg := &pb.EnrichedFlow{RemoteCountry: "US", DstCountry: "DE"}
+	tests := map[string]bool{
+		`country us`:                true,
+		`country de`:                false, // undirected means remote
+		`remote country us`:         true,
+		`remote continent {europe}`: false,
+		`local country de`:          true,
+		`src country us`:            false, // not enriched
+		`either country de`:         true,
+		`either country us`:         true,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+		}
+		filter := &Filter{}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// without the remote country, remote refers to the source of incoming flows
+	expr, _ := parser.Parse(`remote country fr`)
+	if result, _ := (&Filter{}).CheckFlow(expr, &pb.EnrichedFlow{SrcCountry: "FR"}); !result {
+		t.Errorf("Filter `remote country fr` ignored the source country.\n")
+	}
+}
+
+func TestComparableFields(t *testing.T) {
+	for name, fieldType := range parser.ComparableFields {
+		var ok bool
+		switch fieldType {
+		case parser.AddressField:
+			_, ok = addressFields[name]
+		default:
+			_, ok = numberFields[name]
+		}
+		if !ok {
+			t.Errorf("Comparable %s field %q has no getter.\n", fieldType, name)
+		}
+	}
+}
+
 func TestError(t *testing.T) {
 	// This test is for errors that are caught and thrown by the flow
 	// filter visitor alone. Hence, we still error out if an error occurs
@@ -338,6 +1170,15 @@ func TestError(t *testing.T) {
 	tests := []string{
 		`port 1024-10`,
 		`iface speed 1024-10`,
+		`dscp cs7-cs1`,
+		`status hardware-acldeny`,
+		`icmp type 5-3`,
+		`mpls label 17-16`,
+		`mpls depth 3-2`,
+		`ttl 255-1`,
+		`age 10-5`,
+		`sequence 2-1`,
+		`aspath length 5-1`,
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,84 @@
+package visitors
+
+import (
+	"net"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP resolves addresses to ISO 3166-1 alpha-2 country codes. It is
+// consulted by country and continent matches on flows which have not been
+// enriched with the respective country. An empty string means the address
+// could not be resolved.
+type GeoIP interface {
+	Country(address net.IP) string
+}
+
+// maxMindCacheSize is the number of addresses a MaxMindGeoIP remembers
+// before starting over.
+const maxMindCacheSize = 1 << 16
+
+// MaxMindGeoIP is a GeoIP backed by a local MaxMind DB file, such as
+// GeoLite2-Country. Results are cached per address. It is safe for concurrent
+// use.
+type MaxMindGeoIP struct {
+	reader *maxminddb.Reader
+
+	mutex sync.Mutex
+	cache map[string]string
+}
+
+// OpenMaxMindGeoIP opens a MaxMind DB file containing country records.
+func OpenMaxMindGeoIP(path string) (*MaxMindGeoIP, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxMindGeoIP{reader: reader, cache: make(map[string]string)}, nil
+}
+
+// Close releases the underlying database. The GeoIP must not be used
+// afterwards.
+func (g *MaxMindGeoIP) Close() error {
+	return g.reader.Close()
+}
+
+// Country returns the country of an address, falling back to the country the
+// address block is registered in. Addresses missing from the database or
+// failing to be looked up resolve to an empty string.
+func (g *MaxMindGeoIP) Country(address net.IP) string {
+	if address == nil {
+		return ""
+	}
+	key := string(address.To16())
+	g.mutex.Lock()
+	country, ok := g.cache[key]
+	g.mutex.Unlock()
+	if ok {
+		return country
+	}
+
+	var record struct {
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		RegisteredCountry struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"registered_country"`
+	}
+	if err := g.reader.Lookup(address, &record); err == nil {
+		country = record.Country.IsoCode
+		if country == "" {
+			country = record.RegisteredCountry.IsoCode
+		}
+	}
+
+	g.mutex.Lock()
+	if len(g.cache) >= maxMindCacheSize {
+		g.cache = make(map[string]string)
+	}
+	g.cache[key] = country
+	g.mutex.Unlock()
+	return country
+}
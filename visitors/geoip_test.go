@@ -0,0 +1,219 @@
+package visitors
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/BelWue/flowfilter/parser"
+	"github.com/BelWue/flowpipeline/pb"
+)
+
+// mmdbEncode encodes a value in the MaxMind DB data section format. Only the
+// types needed for country databases are supported.
+func mmdbEncode(value any) []byte {
+	control := func(kind byte, size int) []byte {
+		if kind > 7 {
+			return []byte{byte(size), kind - 7}
+		}
+		return []byte{kind<<5 | byte(size)}
+	}
+	unsigned := func(kind byte, n uint64) []byte {
+		var b []byte
+		for ; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		return append(control(kind, len(b)), b...)
+	}
+	switch v := value.(type) {
+	case string:
+		return append(control(2, len(v)), v...)
+	case uint16:
+		return unsigned(5, uint64(v))
+	case uint32:
+		return unsigned(6, uint64(v))
+	case uint64:
+		return unsigned(9, v)
+	case []any:
+		b := control(11, len(v))
+		for _, item := range v {
+			b = append(b, mmdbEncode(item)...)
+		}
+		return b
+	case map[string]any:
+		var keys []string
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b := control(7, len(v))
+		for _, key := range keys {
+			b = append(b, mmdbEncode(key)...)
+			b = append(b, mmdbEncode(v[key])...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+// writeMaxMindDB writes an IPv6 MaxMind DB with 24 bit records, mapping
+// disjoint networks to records.
+func writeMaxMindDB(t *testing.T, networks map[string]map[string]any) string {
+	type node struct {
+		child [2]int // 0 if unset, the root is never a child
+		data  [2]int // offset into the data section plus one, 0 if unset
+	}
+	nodes := []node{{}}
+	var data []byte
+	for cidr, record := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, size := network.Mask.Size()
+		address := network.IP.To16()
+		if size == 32 { // IPv4 lives in ::/96
+			address = make(net.IP, 16)
+			copy(address[12:], network.IP.To4())
+			ones += 96
+		}
+		n := 0
+		for i := 0; i < ones-1; i++ {
+			bit := address[i/8] >> (7 - i%8) & 1
+			if nodes[n].child[bit] == 0 {
+				nodes = append(nodes, node{})
+				nodes[n].child[bit] = len(nodes) - 1
+			}
+			n = nodes[n].child[bit]
+		}
+		bit := address[(ones-1)/8] >> (7 - (ones-1)%8) & 1
+		nodes[n].data[bit] = len(data) + 1
+		data = append(data, mmdbEncode(record)...)
+	}
+
+	var db []byte
+	count := uint32(len(nodes))
+	for _, n := range nodes {
+		for i := range 2 {
+			record := count // no data
+			if n.child[i] != 0 {
+				record = uint32(n.child[i])
+			} else if n.data[i] != 0 {
+				record = count + 16 + uint32(n.data[i]-1)
+			}
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], record)
+			db = append(db, b[1:]...)
+		}
+	}
+	db = append(db, make([]byte, 16)...)
+	db = append(db, data...)
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, mmdbEncode(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1760000000),
+		"database_type":               "Test-Country",
+		"description":                 map[string]any{},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{},
+		"node_count":                  count,
+		"record_size":                 uint16(24),
+	})...)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, db, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openTestGeoIP(t *testing.T) *MaxMindGeoIP {
+	country := func(code string) map[string]any {
+		return map[string]any{"iso_code": code}
+	}
+	path := writeMaxMindDB(t, map[string]map[string]any{
+		"10.0.0.0/8":      {"country": country("DE")},
+		"192.0.2.0/24":    {"country": country("JP")},
+		"2001:db8::/32":   {"country": country("US")},
+		"198.51.100.0/24": {"registered_country": country("FR")},
+	})
+	geoip, err := OpenMaxMindGeoIP(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { geoip.Close() })
+	return geoip
+}
+
+func TestMaxMindGeoIP(t *testing.T) {
+	geoip := openTestGeoIP(t)
+	tests := map[string]string{
+		"10.1.2.3":      "DE",
+		"192.0.2.1":     "JP",
+		"2001:db8::1":   "US",
+		"198.51.100.1":  "FR", // registered country only
+		"203.0.113.1":   "",
+		"2001:db9::1":   "",
+		"::ffff:10.0.0": "", // does not parse
+	}
+	for address, expected := range tests {
+		for range 2 { // the second lookup is cached
+			if country := geoip.Country(net.ParseIP(address)); country != expected {
+				t.Errorf("Address %s resolved to %q, expected %q.\n", address, country, expected)
+			}
+		}
+	}
+}
+
+func TestGeoIP(t *testing.T) {
+	flowmsg := &pb.EnrichedFlow{
+		SrcAddr: net.ParseIP("10.0.0.1"),
+		DstAddr: net.ParseIP("2001:db8::1"),
+	}
+	tests := map[string]bool{
+		`src country de`:                  true,
+		`dst country us`:                  true,
+		`country de`:                      true, // incoming flow, remote is src
+		`country jp`:                      false,
+		`remote country de`:               true,
+		`src continent europe`:            true,
+		`dst continent north-america`:     true,
+		`dst country eu`:                  false,
+		`has src country and has country`: true,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+			continue
+		}
+		filter := &Filter{GeoIP: openTestGeoIP(t)}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// enriched countries take precedence
+	expr, _ := parser.Parse(`src country de`)
+	enriched := &pb.EnrichedFlow{SrcAddr: net.ParseIP("10.0.0.1"), SrcCountry: "AT"}
+	if result, _ := (&Filter{GeoIP: openTestGeoIP(t)}).CheckFlow(expr, enriched); result {
+		t.Errorf("Filter `src country de` ignored the enriched country.\n")
+	}
+
+	// unresolvable addresses stay unknown
+	expr, _ = parser.Parse(`not src country de`)
+	unknown := &pb.EnrichedFlow{SrcAddr: net.ParseIP("203.0.113.1")}
+	filter := &Filter{GeoIP: openTestGeoIP(t), ThreeValued: true}
+	if result, _ := filter.CheckFlow(expr, unknown); result {
+		t.Errorf("Filter `not src country de` matched an unresolvable address.\n")
+	}
+}
@@ -14,53 +14,105 @@ func (noop *Noop) Visit(n parser.Node, next func() error) error {
 	// Before processing a node's children.
 	switch node := n.(type) {
 	case *parser.Address:
+	case *parser.AddressPrefix:
+	case *parser.AgeRangeMatch:
 	case *parser.AddressMatch:
+	case *parser.AsPathFirstRangeMatch:
+	case *parser.AsPathLengthRangeMatch:
+	case *parser.AsPathMatch:
+	case *parser.AsPathOriginRangeMatch:
+	case *parser.AsPathRegex:
 	case *parser.AsnRangeMatch:
 	case *parser.Boolean:
 	case *parser.BpsRangeMatch:
 	case *parser.ByteRangeMatch:
 	case *parser.CidRangeMatch:
+	case *parser.Comparison:
+	case *parser.Continent:
+	case *parser.ContinentMatch:
+	case *parser.CountryCode:
+	case *parser.CountryMatch:
+	case *parser.CustomerMatch:
 	case *parser.DirectionalMatchGroup:
+	case *parser.DscpClass:
 	case *parser.DscpKey:
 	case *parser.DscpMatch:
+	case *parser.Duration:
 	case *parser.DurationRangeMatch:
 	case *parser.EcnKey:
 	case *parser.EcnMatch:
+	case *parser.EncapMatch:
 	case *parser.EtypeKey:
 	case *parser.EtypeMatch:
 	case *parser.Expression:
+	case *parser.FieldRef:
 	case *parser.FlowDirectionMatch:
+	case *parser.FlowLabelRangeMatch:
+	case *parser.FlowTypeKey:
+	case *parser.FlowTypeMatch:
+	case *parser.FragmentIdRangeMatch:
+	case *parser.FragmentMatch:
+	case *parser.FragmentOffsetRangeMatch:
+	case *parser.HasMatch:
 	case *parser.IcmpMatch:
+	case *parser.IcmpMessage:
+	case *parser.IcmpRangeMatch:
 	case *parser.IfSpeedRangeMatch:
+	case *parser.InterfaceKey:
 	case *parser.InterfaceMatch:
 	case *parser.IpTosRangeMatch:
 	case *parser.LocalPrefRangeMatch:
+	case *parser.Location:
+	case *parser.MacAddress:
+	case *parser.MacMatch:
 	case *parser.MedRangeMatch:
+	case *parser.MplsDepthRangeMatch:
+	case *parser.MplsLabelRangeMatch:
+	case *parser.MplsMatch:
+	case *parser.MplsTtlRangeMatch:
 	case *parser.NetsizeRangeMatch:
 	case *parser.NextHopAsnMatch:
 	case *parser.NextHopMatch:
 	case *parser.NormalizedMatch:
 	case *parser.Number:
+	case *parser.NumericRange:
+	case *parser.Operand:
 	case *parser.PacketRangeMatch:
 	case *parser.PassesThroughListMatch:
+	case *parser.PortMatch:
 	case *parser.PortRangeMatch:
 	case *parser.PpsRangeMatch:
+	case *parser.PrefixMatch:
+	case *parser.Product:
+	case *parser.ProductOperation:
 	case *parser.ProtoKey:
 	case *parser.ProtoMatch:
 	case *parser.RangeEnd:
 	case *parser.RegularMatchGroup:
-	case *parser.RemoteCountryMatch:
 	case *parser.RouterMatch:
 	case *parser.RpkiKey:
 	case *parser.RpkiMatch:
 	case *parser.SamplingRateRangeMatch:
+	case *parser.SequenceNumRangeMatch:
+	case *parser.ServiceKey:
 	case *parser.Statement:
+	case *parser.StatusClass:
 	case *parser.StatusKey:
 	case *parser.StatusMatch:
+	case *parser.StatusRangeMatch:
 	case *parser.String:
+	case *parser.Sum:
+	case *parser.SumOperation:
 	case *parser.TcpFlagsKey:
 	case *parser.TcpFlagsMatch:
+	case *parser.TimeMatch:
+	case *parser.TimeOfDay:
+	case *parser.TimeOfDayRange:
+	case *parser.Timestamp:
+	case *parser.TtlRangeMatch:
+	case *parser.VlanRangeMatch:
 	case *parser.VrfRangeMatch:
+	case *parser.WeekdayRange:
 	default:
 		return fmt.Errorf("Encountered unknown node type: %T", node)
 	}
@@ -73,53 +125,105 @@ func (noop *Noop) Visit(n parser.Node, next func() error) error {
 	// After processing all children...
 	switch node := n.(type) {
 	case *parser.Address:
+	case *parser.AddressPrefix:
+	case *parser.AgeRangeMatch:
 	case *parser.AddressMatch:
+	case *parser.AsPathFirstRangeMatch:
+	case *parser.AsPathLengthRangeMatch:
+	case *parser.AsPathMatch:
+	case *parser.AsPathOriginRangeMatch:
+	case *parser.AsPathRegex:
 	case *parser.AsnRangeMatch:
 	case *parser.Boolean:
 	case *parser.BpsRangeMatch:
 	case *parser.ByteRangeMatch:
 	case *parser.CidRangeMatch:
+	case *parser.Comparison:
+	case *parser.Continent:
+	case *parser.ContinentMatch:
+	case *parser.CountryCode:
+	case *parser.CountryMatch:
+	case *parser.CustomerMatch:
 	case *parser.DirectionalMatchGroup:
+	case *parser.DscpClass:
 	case *parser.DscpKey:
 	case *parser.DscpMatch:
+	case *parser.Duration:
 	case *parser.DurationRangeMatch:
 	case *parser.EcnKey:
 	case *parser.EcnMatch:
+	case *parser.EncapMatch:
 	case *parser.EtypeKey:
 	case *parser.EtypeMatch:
 	case *parser.Expression:
+	case *parser.FieldRef:
 	case *parser.FlowDirectionMatch:
+	case *parser.FlowLabelRangeMatch:
+	case *parser.FlowTypeKey:
+	case *parser.FlowTypeMatch:
+	case *parser.FragmentIdRangeMatch:
+	case *parser.FragmentMatch:
+	case *parser.FragmentOffsetRangeMatch:
+	case *parser.HasMatch:
 	case *parser.IcmpMatch:
+	case *parser.IcmpMessage:
+	case *parser.IcmpRangeMatch:
 	case *parser.IfSpeedRangeMatch:
+	case *parser.InterfaceKey:
 	case *parser.InterfaceMatch:
 	case *parser.IpTosRangeMatch:
 	case *parser.LocalPrefRangeMatch:
+	case *parser.Location:
+	case *parser.MacAddress:
+	case *parser.MacMatch:
 	case *parser.MedRangeMatch:
+	case *parser.MplsDepthRangeMatch:
+	case *parser.MplsLabelRangeMatch:
+	case *parser.MplsMatch:
+	case *parser.MplsTtlRangeMatch:
 	case *parser.NetsizeRangeMatch:
 	case *parser.NextHopAsnMatch:
 	case *parser.NextHopMatch:
 	case *parser.NormalizedMatch:
 	case *parser.Number:
+	case *parser.NumericRange:
+	case *parser.Operand:
 	case *parser.PacketRangeMatch:
 	case *parser.PassesThroughListMatch:
+	case *parser.PortMatch:
 	case *parser.PortRangeMatch:
 	case *parser.PpsRangeMatch:
+	case *parser.PrefixMatch:
+	case *parser.Product:
+	case *parser.ProductOperation:
 	case *parser.ProtoKey:
 	case *parser.ProtoMatch:
 	case *parser.RangeEnd:
 	case *parser.RegularMatchGroup:
-	case *parser.RemoteCountryMatch:
 	case *parser.RouterMatch:
 	case *parser.RpkiKey:
 	case *parser.RpkiMatch:
 	case *parser.SamplingRateRangeMatch:
+	case *parser.SequenceNumRangeMatch:
+	case *parser.ServiceKey:
 	case *parser.Statement:
+	case *parser.StatusClass:
 	case *parser.StatusKey:
 	case *parser.StatusMatch:
+	case *parser.StatusRangeMatch:
 	case *parser.String:
+	case *parser.Sum:
+	case *parser.SumOperation:
 	case *parser.TcpFlagsKey:
 	case *parser.TcpFlagsMatch:
+	case *parser.TimeMatch:
+	case *parser.TimeOfDay:
+	case *parser.TimeOfDayRange:
+	case *parser.Timestamp:
+	case *parser.TtlRangeMatch:
+	case *parser.VlanRangeMatch:
 	case *parser.VrfRangeMatch:
+	case *parser.WeekdayRange:
 	default:
 		_ = node
 	}
@@ -40,6 +40,51 @@ func reverseMap(m map[string]uint64) map[uint64]string {
 	return n
 }
 
+// magicOrNumber returns the magic string for a value if there is one.
+func magicOrNumber(m map[string]uint64, value uint64) string {
+	if magic, ok := reverseMap(m)[value]; ok {
+		return magic
+	}
+	return fmt.Sprintf("%d", value)
+}
+
+// magicRange returns a range using magic strings if both ends have one.
+func magicRange(m map[string]uint64, lower uint64, upper uint64) string {
+	reverse := reverseMap(m)
+	lowerMagic, lowerOk := reverse[lower]
+	upperMagic, upperOk := reverse[upper]
+	if lowerOk && upperOk {
+		return fmt.Sprintf("%s-%s", lowerMagic, upperMagic)
+	}
+	return fmt.Sprintf("%d-%d", lower, upper)
+}
+
+// quote returns a string literal of s. The lexer does not know escapes, so
+// single quotes are used if s contains double quotes.
+func quote(s string) string {
+	if strings.Contains(s, `"`) {
+		return "'" + s + "'"
+	}
+	return `"` + s + `"`
+}
+
+// printSet prints a set literal, i.e. `{22, 80-88}`, by visiting the given
+// nodes in order. It is used in place of descending to a node's children.
+func printSet[T parser.Node](p *Printer, nodes []T) error {
+	start := len(p.output)
+	for i, node := range nodes {
+		if i > 0 {
+			p.output[len(p.output)-1] += ","
+		}
+		if err := parser.Visit(node, p.Visit); err != nil {
+			return err
+		}
+	}
+	p.output[start] = "{" + p.output[start]
+	p.output[len(p.output)-1] += "}"
+	return nil
+}
+
 func (p *Printer) Visit(n parser.Node, next func() error) error {
 	// Before processing a node's children, do different things for
 	// different types of nodes.
@@ -64,6 +109,36 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 			p.output = append(p.output, fmt.Sprint(*node.Address))
 		}
 	case *parser.Address:
+	case *parser.AddressPrefix:
+		if node.Mask != nil {
+			var mask net.IPMask
+			if node.Address.To4() != nil {
+				mask = net.CIDRMask(int(*node.Mask), 32)
+			} else {
+				mask = net.CIDRMask(int(*node.Mask), 128)
+			}
+			ipnet := &net.IPNet{IP: *node.Address, Mask: mask}
+			p.output = append(p.output, fmt.Sprint(ipnet))
+		} else {
+			p.output = append(p.output, fmt.Sprint(*node.Address))
+		}
+	case *parser.AgeRangeMatch:
+		p.output = append(p.output, "age")
+	case *parser.AsPathFirstRangeMatch:
+		p.output = append(p.output, "first")
+	case *parser.AsPathLengthRangeMatch:
+		p.output = append(p.output, "length")
+	case *parser.AsPathMatch:
+		p.output = append(p.output, "aspath")
+		if node.Prepended {
+			p.output = append(p.output, "prepended")
+		} else if node.ContainsPrivate {
+			p.output = append(p.output, "contains-private")
+		}
+	case *parser.AsPathOriginRangeMatch:
+		p.output = append(p.output, "origin")
+	case *parser.AsPathRegex:
+		p.output = append(p.output, "~", quote(node.Expr))
 	case *parser.AsnRangeMatch:
 		p.output = append(p.output, "asn")
 	case *parser.Boolean:
@@ -72,11 +147,39 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 		}
 	case *parser.BpsRangeMatch:
 		p.output = append(p.output, "bps")
+		if node.Scaled {
+			p.output = append(p.output, "scaled")
+		}
 	case *parser.ByteRangeMatch:
 		p.output = append(p.output, "bytes")
+		if node.Scaled {
+			p.output = append(p.output, "scaled")
+		}
 	case *parser.CidRangeMatch:
 		p.output = append(p.output, "cid")
+	case *parser.Comparison: // no syntax elements here
+	case *parser.Continent:
+		p.output = append(p.output, string(*node))
+	case *parser.ContinentMatch:
+		p.output = append(p.output, "continent")
+		if node.Continents != nil {
+			return printSet(p, node.Continents)
+		}
+	case *parser.CountryCode:
+		p.output = append(p.output, string(*node))
+	case *parser.CountryMatch:
+		p.output = append(p.output, "country")
+		if node.Countries != nil {
+			return printSet(p, node.Countries)
+		}
+	case *parser.CustomerMatch:
+		p.output = append(p.output, "customer")
+		if node.Regex {
+			p.output = append(p.output, "~")
+		}
+		p.output = append(p.output, quote(node.Name))
 	case *parser.DirectionalMatchGroup: // no syntax elements here
+	case *parser.Duration: // printed by TimeMatch
 	case *parser.DurationRangeMatch:
 		p.output = append(p.output, "duration")
 	case *parser.DscpKey:
@@ -85,8 +188,14 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 		} else {
 			p.output = append(p.output, fmt.Sprintf("%d", *node))
 		}
+	case *parser.DscpClass:
+		p.output = append(p.output, reverseMap(parser.DscpClassMagicMap)[uint64(*node)])
 	case *parser.DscpMatch:
 		p.output = append(p.output, "dscp")
+		if node.Lower != nil {
+			p.output = append(p.output, magicRange(parser.DscpMagicMap, uint64(*node.Lower), uint64(*node.Upper)))
+			return nil
+		}
 	case *parser.EcnKey:
 		if magic, ok := reverseMap(parser.EcnMagicMap)[uint64(*node)]; ok {
 			p.output = append(p.output, magic)
@@ -95,6 +204,14 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 		}
 	case *parser.EcnMatch:
 		p.output = append(p.output, "ecn")
+		if node.Capable {
+			p.output = append(p.output, "capable")
+		}
+	case *parser.EncapMatch:
+		p.output = append(p.output, "encap")
+		if node.Present {
+			p.output = append(p.output, "present")
+		}
 	case *parser.EtypeKey:
 		if magic, ok := reverseMap(parser.EtypeMagicMap)[uint64(*node)]; ok {
 			p.output = append(p.output, magic)
@@ -104,38 +221,141 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 	case *parser.EtypeMatch:
 		p.output = append(p.output, "etype")
 	case *parser.Expression: // no syntax elements here
+	case *parser.FieldRef: // no syntax elements here
 	case *parser.FlowDirectionMatch:
 		p.output = append(p.output, "direction")
+	case *parser.FlowTypeKey:
+		p.output = append(p.output, magicOrNumber(parser.FlowTypeMagicMap, uint64(*node)))
+	case *parser.FlowTypeMatch:
+		p.output = append(p.output, "type")
+		if node.FlowTypeKeys != nil {
+			return printSet(p, node.FlowTypeKeys)
+		}
+	case *parser.FlowLabelRangeMatch:
+		p.output = append(p.output, "flowlabel")
+	case *parser.FragmentIdRangeMatch:
+		p.output = append(p.output, "fragment-id")
+	case *parser.FragmentMatch: // no syntax elements here
+	case *parser.FragmentOffsetRangeMatch:
+		p.output = append(p.output, "fragment-offset")
+	case *parser.HasMatch:
+		p.output = append(p.output, "has")
 	case *parser.IcmpMatch:
-		p.output = append(p.output, "icmp")
+		p.output = append(p.output, string(*node.Version))
+		switch {
+		case node.TypeName != nil:
+			p.output = append(p.output, "type")
+			return parser.Visit(node.TypeName, p.Visit)
+		case node.Type != nil:
+			p.output = append(p.output, "type")
+			return parser.Visit(node.Type, p.Visit)
+		case node.Code != nil:
+			p.output = append(p.output, "code")
+			return parser.Visit(node.Code, p.Visit)
+		case node.Messages != nil:
+			return printSet(p, node.Messages)
+		}
+		return parser.Visit(node.Message, p.Visit)
+	case *parser.IcmpMessage: // no syntax elements here
+	case *parser.IcmpRangeMatch:
+		if node.Ranges != nil {
+			return printSet(p, node.Ranges)
+		}
 	case *parser.IfSpeedRangeMatch:
 		p.output = append(p.output, "speed")
+	case *parser.InterfaceKey:
+		id, router := node.Key()
+		switch {
+		case node.Scoped != nil:
+			p.output = append(p.output, fmt.Sprintf("%s:%d", router, id))
+		case router != nil:
+			p.output = append(p.output, fmt.Sprint(id), "on", "router", router.String())
+		default:
+			p.output = append(p.output, fmt.Sprint(id))
+		}
 	case *parser.InterfaceMatch:
 		p.output = append(p.output, "interface")
+		if node.SnmpIds != nil {
+			return printSet(p, node.SnmpIds)
+		}
 	case *parser.IpTosRangeMatch:
 		p.output = append(p.output, "iptos")
 	case *parser.LocalPrefRangeMatch:
 		p.output = append(p.output, "localpref")
+	case *parser.Location: // printed by TimeMatch
+	case *parser.MacAddress:
+		mac := net.HardwareAddr(*node).String()
+		if len(*node) < 6 {
+			mac += ":*"
+		}
+		p.output = append(p.output, mac)
+	case *parser.MacMatch:
+		p.output = append(p.output, "mac")
 	case *parser.MedRangeMatch:
 		p.output = append(p.output, "med")
+	case *parser.MplsDepthRangeMatch:
+		p.output = append(p.output, "depth")
+	case *parser.MplsLabelRangeMatch:
+		p.output = append(p.output, "label")
+	case *parser.MplsMatch:
+		p.output = append(p.output, "mpls")
+		if node.Present {
+			p.output = append(p.output, "present")
+		}
+	case *parser.MplsTtlRangeMatch:
+		p.output = append(p.output, "ttl")
 	case *parser.NetsizeRangeMatch:
 		p.output = append(p.output, "netsize")
 	case *parser.NextHopMatch:
 		p.output = append(p.output, "nexthop")
+		if node.Addresses != nil {
+			return printSet(p, node.Addresses)
+		}
 	case *parser.NextHopAsnMatch:
 		p.output = append(p.output, "nexthopasn")
 	case *parser.NormalizedMatch:
 		p.output = append(p.output, "normalized")
 	case *parser.Number:
 		p.output = append(p.output, fmt.Sprintf("%d", *node))
+	case *parser.NumericRange: // no syntax elements here
+	case *parser.Operand:
+		// in case it's a Sum, wrap it
+		if node.Sum != nil {
+			p.output = append(p.output, "(")
+		}
 	case *parser.PacketRangeMatch:
 		p.output = append(p.output, "packets")
-	case *parser.PortRangeMatch:
+		if node.Scaled {
+			p.output = append(p.output, "scaled")
+		}
+	case *parser.PortMatch:
 		p.output = append(p.output, "port")
+		if node.Ports != nil {
+			return printSet(p, node.Ports)
+		}
+	case *parser.PortRangeMatch: // no syntax elements here
 	case *parser.PpsRangeMatch:
 		p.output = append(p.output, "pps")
+		if node.Scaled {
+			p.output = append(p.output, "scaled")
+		}
 	case *parser.PassesThroughListMatch:
 		p.output = append(p.output, "passes-through")
+	case *parser.PrefixMatch:
+		mask := net.CIDRMask(int(*node.Mask), node.Bits())
+		p.output = append(p.output, "prefix", fmt.Sprint(&net.IPNet{IP: *node.Address, Mask: mask}))
+		switch {
+		case node.Exact:
+			p.output = append(p.output, "exact")
+		case node.OrLonger:
+			p.output = append(p.output, "orlonger")
+		case node.Longer:
+			p.output = append(p.output, "longer")
+		case node.UpTo != nil:
+			p.output = append(p.output, "upto", fmt.Sprintf("/%d", *node.UpTo))
+		}
+	case *parser.Product: // no syntax elements here
+	case *parser.ProductOperation: // no syntax elements here
 	case *parser.ProtoKey:
 		if magic, ok := reverseMap(parser.ProtoMagicMap)[uint64(*node)]; ok {
 			p.output = append(p.output, magic)
@@ -147,27 +367,47 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 	case *parser.RangeEnd:
 		p.output = append(p.output, fmt.Sprintf("- %d", *node))
 	case *parser.RegularMatchGroup: // no syntax elements here
-	case *parser.RemoteCountryMatch:
-		p.output = append(p.output, "country")
 	case *parser.RouterMatch:
 		p.output = append(p.output, "router")
+		if node.Addresses != nil {
+			return printSet(p, node.Addresses)
+		}
 	case *parser.SamplingRateRangeMatch:
 		p.output = append(p.output, "samplingrate")
+	case *parser.SequenceNumRangeMatch:
+		p.output = append(p.output, "sequence")
+	case *parser.ServiceKey:
+		if magic, ok := reverseMap(parser.ServiceMagicMap)[uint64(*node)]; ok {
+			p.output = append(p.output, magic)
+		} else {
+			p.output = append(p.output, fmt.Sprintf("%d", *node))
+		}
 	case *parser.Statement:
 		// in case it's a SubExpression, wrap it
 		if node.SubExpression != nil {
 			p.output = append(p.output, "(")
 		} // else children will handle themselves
+	case *parser.StatusClass:
+		p.output = append(p.output, "class", reverseMap(parser.StatusClassMagicMap)[uint64(*node)])
 	case *parser.StatusKey:
-		if magic, ok := reverseMap(parser.StatusMagicMap)[uint64(*node)]; ok {
-			p.output = append(p.output, magic)
-		} else {
-			p.output = append(p.output, fmt.Sprintf("%d", *node))
-		}
+		p.output = append(p.output, magicOrNumber(parser.StatusMagicMap, uint64(*node)))
 	case *parser.StatusMatch:
 		p.output = append(p.output, "status")
+		if node.Statuses != nil {
+			p.output = append(p.output, "reason")
+			return printSet(p, node.Statuses)
+		} else if node.Status != nil {
+			p.output = append(p.output, "reason")
+		}
+	case *parser.StatusRangeMatch:
+		if node.Lower != nil {
+			p.output = append(p.output, magicRange(parser.StatusMagicMap, uint64(*node.Lower), uint64(*node.Upper)))
+			return nil
+		}
 	case *parser.String:
 		p.output = append(p.output, string(*node))
+	case *parser.Sum: // no syntax elements here
+	case *parser.SumOperation: // no syntax elements here
 	case *parser.TcpFlagsKey:
 		if magic, ok := reverseMap(parser.TcpFlagsMagicMap)[uint64(*node)]; ok {
 			p.output = append(p.output, magic)
@@ -176,6 +416,12 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 		}
 	case *parser.TcpFlagsMatch:
 		p.output = append(p.output, "tcpflags")
+		if node.TcpFlagsKeys != nil {
+			if node.Quantifier != nil {
+				p.output = append(p.output, string(*node.Quantifier))
+			}
+			return printSet(p, node.TcpFlagsKeys)
+		}
 	case *parser.RpkiKey:
 		if magic, ok := reverseMap(parser.RpkiMagicMap)[uint64(*node)]; ok {
 			p.output = append(p.output, magic)
@@ -184,8 +430,36 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 		}
 	case *parser.RpkiMatch:
 		p.output = append(p.output, "rpki")
+	case *parser.TimeMatch:
+		if node.Field != nil {
+			p.output = append(p.output, string(*node.Field))
+		}
+		switch {
+		case node.TimeOfDay != nil:
+			p.output = append(p.output, "time", fmt.Sprintf("%s-%s", node.TimeOfDay.Lower, node.TimeOfDay.Upper))
+		case node.Weekdays != nil:
+			p.output = append(p.output, "weekday", node.Weekdays.String())
+		case node.After != nil:
+			p.output = append(p.output, "after", node.After.Expr)
+		case node.Before != nil:
+			p.output = append(p.output, "before", node.Before.Expr)
+		case node.Within != nil:
+			p.output = append(p.output, "within", node.Within.String())
+		}
+		if node.Location != nil {
+			p.output = append(p.output, "in", fmt.Sprintf(`"%s"`, node.Location.Name))
+		}
+		return nil
+	case *parser.TimeOfDay: // printed by TimeMatch
+	case *parser.TimeOfDayRange: // printed by TimeMatch
+	case *parser.Timestamp: // printed by TimeMatch
+	case *parser.TtlRangeMatch:
+		p.output = append(p.output, "ttl")
+	case *parser.VlanRangeMatch:
+		p.output = append(p.output, "vlan")
 	case *parser.VrfRangeMatch:
 		p.output = append(p.output, "vrf")
+	case *parser.WeekdayRange: // printed by TimeMatch
 	default:
 		return fmt.Errorf("Encountered unknown node type: %T", node)
 	}
@@ -197,6 +471,10 @@ func (p *Printer) Visit(n parser.Node, next func() error) error {
 
 	// After processing all children...
 	switch node := n.(type) {
+	case *parser.Operand:
+		if node.Sum != nil {
+			p.output = append(p.output, ")")
+		}
 	case *parser.Statement:
 		if node.SubExpression != nil {
 			p.output = append(p.output, ")")
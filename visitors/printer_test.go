@@ -0,0 +1,151 @@
+package visitors
+
+import (
+	"testing"
+
+	"github.com/BelWue/flowfilter/parser"
+)
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{`port 22`, `port 22`},
+		{`port ssh`, `port ssh`},
+		{`port www`, `port http`},
+		{`dst port {https, dns}`, `dst port {https, domain}`},
+		{`port {rdp, mssql}`, `port {ms-wbt-server, ms-sql-s}`},
+		{`src port {22, 80-88}`, `src port {22, 80 - 88}`},
+		{`proto 47`, `proto 47`},
+		{`proto gre`, `proto gre`},
+		{`proto ipv6-icmp`, `proto icmpv6`},
+		{`country il`, `country il`},
+		{`dscp ef`, `dscp ef`},
+		{`dscp cs0`, `dscp default`},
+		{`dscp af4x`, `dscp af4x`},
+		{`dscp cs5-cs7`, `dscp cs5-cs7`},
+		{`dscp 10-12`, `dscp af11-af12`},
+		{`ecn capable`, `ecn capable`},
+		{`ecn notect`, `ecn notect`},
+		{`status dropped`, `status class dropped`},
+		{`status policerdrop`, `status reason policer`},
+		{`status 139`, `status reason wred`},
+		{`status {wred, rpf}`, `status reason {wred, rpf}`},
+		{`status 128-143`, `status reason 128-143`},
+		{`tcpflags finack`, `tcpflags finack`},
+		{`tcpflags any {syn, rst}`, `tcpflags any {syn, rst}`},
+		{`tcpflags only syn`, `tcpflags only syn`},
+		{`tcpflags none 0x11`, `tcpflags none 17`},
+		{`icmp type 3`, `icmp type 3`},
+		{`icmp type echo-request`, `icmp type echo-request`},
+		{`icmp code {0, 3-5}`, `icmp code {0, 3 - 5}`},
+		{`icmp dest-unreach port-unreach`, `icmp dest-unreach port-unreach`},
+		{`icmpv6 {neighbor-solicit, neighbor-advert}`, `icmpv6 {neighbor-solicit, neighbor-advert}`},
+		{`src mac 00-1B-21-3A-4B-5C`, `src mac 00:1b:21:3a:4b:5c`},
+		{`mac 001b.213a.4b5c`, `mac 00:1b:21:3a:4b:5c`},
+		{`mac 12-34-56-78-9A-BC`, `mac 12:34:56:78:9a:bc`},
+		{`dst mac 00:1b:21:*`, `dst mac 00:1b:21:*`},
+		{`mac broadcast`, `mac broadcast`},
+		{`src vlan 100-199`, `src vlan 100 - 199`},
+		{`mpls present`, `mpls present`},
+		{`mpls depth >2`, `mpls depth > 2`},
+		{`mpls top label 24001`, `mpls top label 24001`},
+		{`mpls ttl <2`, `mpls ttl < 2`},
+		{`encap present`, `encap present`},
+		{`encap proto tcp`, `encap proto tcp`},
+		{`proto encap`, `proto encap`},
+		{`ttl <5`, `ttl < 5`},
+		{`fragment-offset 0`, `fragment-offset 0`},
+		{`not non-first-fragment`, `not non-first-fragment`},
+		{`router 10.0.0.1`, `router 10.0.0.1`},
+		{`router 10.0.0.0/8`, `router 10.0.0.0/8`},
+		{`nexthop {10.0.0.1, 2001:db8::/32}`, `nexthop {10.0.0.1, 2001:db8::/32}`},
+		{`type ipfix`, `type ipfix`},
+		{`type {nfv5, nfv9}`, `type {nfv5, nfv9}`},
+		{`age <300`, `age < 300`},
+		{`age 5m-1h`, `age 300 - 3600`},
+		{`sequence 1-10`, `sequence 1 - 10`},
+		{`aspath ~ '^553 (174|3356) .* 6830$'`, `aspath ~ "^553 (174|3356) .* 6830$"`},
+		{`aspath ~ '^553 _6830$'`, `aspath ~ "^553 _6830$"`},
+		{`aspath length >5`, `aspath length > 5`},
+		{`aspath origin 6830`, `aspath origin 6830`},
+		{`aspath first 553`, `aspath first 553`},
+		{`not aspath prepended`, `not aspath prepended`},
+		{`aspath contains-private`, `aspath contains-private`},
+		{`remote asn 6830`, `remote asn 6830`},
+		{`local port https`, `local port https`},
+		{`egress vrf 2`, `egress vrf 2`},
+		{`both address 10.0.0.0/8`, `both address 10.0.0.0/8`},
+		{`not either asn 553`, `not either asn 553`},
+		{`src asn==dst asn`, `src asn == dst asn`},
+		{`not InIf != OutIf`, `not InIf != OutIf`},
+		{`bytes >= packets`, `bytes >= packets`},
+		{`bytes/packets>1400`, `bytes / packets > 1400`},
+		{`(timeflowend - timeflowstart) > 300`, `( timeflowend - timeflowstart ) > 300`},
+		{`bytes >1G`, `bytes > 1000000000`},
+		{`bps scaled >1G`, `bps scaled > 1000000000`},
+		{`not packets scaled 10-20`, `not packets scaled 10 - 20`},
+		{`time 08:00-18:00 in 'Europe/Berlin'`, `time 08:00-18:00 in "Europe/Berlin"`},
+		{`end time 22:00:30-06:00`, `end time 22:00:30-06:00`},
+		{`weekday sat-mon`, `weekday sat-mon`},
+		{`start after 2026-10-01T00:00Z`, `start after 2026-10-01T00:00Z`},
+		{`received within 90m`, `received within 1h30m`},
+		{`not exists src interface desc`, `not has src interface desc`},
+		{`iface id 5 on router 2001:db8::1`, `interface 5 on router 2001:db8::1`},
+		{`src iface {1,10.0.0.1:2}`, `src interface {1, 10.0.0.1:2}`},
+		{`has rpki`, `has rpki`},
+		{`src country {de,AT}`, `src country {de, AT}`},
+		{`not continent {asia, europe}`, `not continent {asia, europe}`},
+		{`dst rpki invalid`, `dst rpki invalid`},
+		{`src prefix 10.0.0.0/16 upto /24`, `src prefix 10.0.0.0/16 upto /24`},
+		{`prefix 2001:db8::/32 orlonger`, `prefix 2001:db8::/32 orlonger`},
+		{`dst prefix 10.0.0.0/8`, `dst prefix 10.0.0.0/8`},
+	}
+
+	for _, test := range tests {
+		expr, err := parser.Parse(test.input)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test.input, err)
+			continue
+		}
+		printer := &Printer{}
+		output := printer.String(expr)
+		if output != test.output {
+			t.Errorf("Filter `%s` printed as `%s`, expected `%s`.\n", test.input, output, test.output)
+		}
+		// the output needs to be valid input too
+		if _, err := parser.Parse(output); err != nil {
+			t.Errorf("Output `%s` failed to parse with error:\n%s\n", output, err)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, value := range []string{`Hu0/0/0`, `"uplink"`, `it's`, ``} {
+		expr, err := parser.Parse(`iface name ` + quote(value))
+		if err != nil {
+			t.Errorf("Quoted %q failed to parse with error:\n%s\n", value, err)
+			continue
+		}
+		name := expr.Left.DirectionalMatch.Interface.Name
+		if name == nil || string(*name) != value {
+			t.Errorf("Quoted %q did not survive parsing.\n", value)
+		}
+	}
+}
+
+func TestPrintCustomer(t *testing.T) {
+	parser.Customers = parser.CustomerMap{"Uni Stuttgart": {1000}, "HS-Aalen": {2001}, `"Die Anstalt" e.V.`: {3000}}
+	t.Cleanup(func() { parser.Customers = nil })
+	for _, test := range []string{`customer "Uni Stuttgart"`, `not src customer ~ "^HS-"`, `customer '"Die Anstalt" e.V.'`} {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+			continue
+		}
+		if output := (&Printer{}).String(expr); output != test {
+			t.Errorf("Filter `%s` printed as `%s`.\n", test, output)
+		}
+	}
+}
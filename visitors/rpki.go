@@ -0,0 +1,138 @@
+package visitors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BelWue/flowpipeline/pb"
+)
+
+// RPKIValidator performs route origin validation as per RFC 6811. It is
+// consulted by rpki matches on flows which have not been validated by
+// enrichment, and by all `src rpki` and `dst rpki` matches.
+type RPKIValidator interface {
+	Validate(prefix *net.IPNet, origin uint32) pb.EnrichedFlow_ValidationStatusType
+}
+
+// vrp is a Validated ROA Payload, authorizing an AS to originate a prefix
+// and its more specifics up to a maximum length.
+type vrp struct {
+	Asn       vrpAsn `json:"asn"`
+	Prefix    string `json:"prefix"`
+	MaxLength int    `json:"maxLength"`
+}
+
+// vrpAsn is an AS number given as number, as by rpki-client, or as string
+// with `AS` prefix, as by Routinator.
+type vrpAsn uint32
+
+func (a *vrpAsn) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("bad asn %s", data)
+	}
+	*a = vrpAsn(n)
+	return nil
+}
+
+// vrpKey identifies a VRP's prefix.
+type vrpKey struct {
+	address [16]byte
+	length  int // of the IPv6 or IPv4-mapped prefix
+}
+
+func newVrpKey(address net.IP, length int) vrpKey {
+	key := vrpKey{length: length}
+	copy(key.address[:], address.To16().Mask(net.CIDRMask(length, 128)))
+	return key
+}
+
+// VRPValidator is a RPKIValidator backed by a JSON export of Validated ROA
+// Payloads as written by rpki-client or Routinator. The export can be
+// reloaded at runtime. It is safe for concurrent use.
+type VRPValidator struct {
+	path string
+
+	mutex sync.RWMutex
+	vrps  map[vrpKey][]vrp
+}
+
+// LoadVRPValidator reads a VRP export from the given path.
+func LoadVRPValidator(path string) (*VRPValidator, error) {
+	validator := &VRPValidator{path: path}
+	if err := validator.Reload(); err != nil {
+		return nil, err
+	}
+	return validator, nil
+}
+
+// Reload rereads the VRP export, i.e. after it has been replaced by a newer
+// one. The previous VRPs are kept if reading fails.
+func (v *VRPValidator) Reload() error {
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		return err
+	}
+	var export struct {
+		Roas []vrp `json:"roas"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return fmt.Errorf("bad VRP export %s: %w", v.path, err)
+	}
+
+	vrps := make(map[vrpKey][]vrp)
+	for _, roa := range export.Roas {
+		_, prefix, err := net.ParseCIDR(roa.Prefix)
+		if err != nil {
+			return fmt.Errorf("bad VRP export %s: %w", v.path, err)
+		}
+		ones, bits := prefix.Mask.Size()
+		if roa.MaxLength < ones || roa.MaxLength > bits {
+			return fmt.Errorf("bad VRP export %s: bad maxLength %d for %s", v.path, roa.MaxLength, roa.Prefix)
+		}
+		if bits == 32 { // keep everything IPv4-mapped
+			ones += 96
+			roa.MaxLength += 96
+		}
+		key := newVrpKey(prefix.IP, ones)
+		vrps[key] = append(vrps[key], roa)
+	}
+
+	v.mutex.Lock()
+	v.vrps = vrps
+	v.mutex.Unlock()
+	return nil
+}
+
+// Validate returns whether the prefix is covered by any VRP, and if so,
+// whether one of them authorizes the origin AS to announce it.
+func (v *VRPValidator) Validate(prefix *net.IPNet, origin uint32) pb.EnrichedFlow_ValidationStatusType {
+	ones, bits := prefix.Mask.Size()
+	if bits == 32 {
+		ones += 96
+	} else if bits != 128 {
+		return pb.EnrichedFlow_Unknown
+	}
+
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	status := pb.EnrichedFlow_NotFound
+	for length := 0; length <= ones; length++ {
+		for _, roa := range v.vrps[newVrpKey(prefix.IP, length)] {
+			status = pb.EnrichedFlow_Invalid
+			if origin != 0 && uint32(roa.Asn) == origin && ones <= roa.MaxLength {
+				return pb.EnrichedFlow_Valid
+			}
+		}
+	}
+	return status
+}
@@ -0,0 +1,157 @@
+package visitors
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BelWue/flowfilter/parser"
+	"github.com/BelWue/flowpipeline/pb"
+)
+
+// as written by rpki-client
+const rpkiClientVRPs = `{
+	"metadata": {"buildmachine": "test", "roas": 3},
+	"roas": [
+		{"asn": 553, "prefix": "10.0.0.0/8", "maxLength": 16, "ta": "ripe", "expires": 1760000000},
+		{"asn": 64512, "prefix": "10.1.0.0/16", "maxLength": 24, "ta": "ripe", "expires": 1760000000},
+		{"asn": 0, "prefix": "192.0.2.0/24", "maxLength": 24, "ta": "ripe", "expires": 1760000000}
+	]
+}`
+
+// as written by Routinator
+const routinatorVRPs = `{
+	"roas": [
+		{"asn": "AS6830", "prefix": "2001:db8::/32", "maxLength": 48, "ta": "ripe"}
+	]
+}`
+
+func writeVRPs(t *testing.T, export string) string {
+	path := filepath.Join(t.TempDir(), "vrps.json")
+	if err := os.WriteFile(path, []byte(export), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVRPValidator(t *testing.T) {
+	ipv4, err := LoadVRPValidator(writeVRPs(t, rpkiClientVRPs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipv6, err := LoadVRPValidator(writeVRPs(t, routinatorVRPs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		validator *VRPValidator
+		prefix    string
+		origin    uint32
+		expected  pb.EnrichedFlow_ValidationStatusType
+	}{
+		{ipv4, "10.0.0.0/8", 553, pb.EnrichedFlow_Valid},
+		{ipv4, "10.2.0.0/16", 553, pb.EnrichedFlow_Valid},
+		{ipv4, "10.2.3.0/24", 553, pb.EnrichedFlow_Invalid}, // too specific
+		{ipv4, "10.0.0.0/8", 6830, pb.EnrichedFlow_Invalid},
+		{ipv4, "10.1.2.0/24", 64512, pb.EnrichedFlow_Valid},
+		{ipv4, "10.1.0.0/16", 553, pb.EnrichedFlow_Valid},    // covered by both
+		{ipv4, "192.0.2.0/24", 553, pb.EnrichedFlow_Invalid}, // AS 0
+		{ipv4, "203.0.113.0/24", 553, pb.EnrichedFlow_NotFound},
+		{ipv4, "0.0.0.0/0", 553, pb.EnrichedFlow_NotFound},
+		{ipv6, "2001:db8:1::/48", 6830, pb.EnrichedFlow_Valid},
+		{ipv6, "2001:db8:1::/64", 6830, pb.EnrichedFlow_Invalid},
+		{ipv6, "2001:db9::/32", 6830, pb.EnrichedFlow_NotFound},
+		{ipv6, "10.0.0.0/8", 553, pb.EnrichedFlow_NotFound},
+	}
+	for _, test := range tests {
+		_, prefix, _ := net.ParseCIDR(test.prefix)
+		if status := test.validator.Validate(prefix, test.origin); status != test.expected {
+			t.Errorf("Prefix %s from AS%d validated as %s, expected %s.\n", test.prefix, test.origin, status, test.expected)
+		}
+	}
+}
+
+func TestVRPValidatorErrors(t *testing.T) {
+	tests := []string{
+		`{"roas": [{"asn": "ASX", "prefix": "10.0.0.0/8", "maxLength": 8}]}`,
+		`{"roas": [{"asn": 553, "prefix": "10.0.0.0", "maxLength": 8}]}`,
+		`{"roas": [{"asn": 553, "prefix": "10.0.0.0/8", "maxLength": 7}]}`,
+		`{"roas": [{"asn": 553, "prefix": "10.0.0.0/8", "maxLength": 33}]}`,
+		`not json`,
+	}
+	for _, test := range tests {
+		if _, err := LoadVRPValidator(writeVRPs(t, test)); err == nil {
+			t.Errorf("VRP export `%s` did not fail to load.\n", test)
+		}
+	}
+}
+
+func TestRPKIValidator(t *testing.T) {
+	validator, err := LoadVRPValidator(writeVRPs(t, rpkiClientVRPs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowmsg := &pb.EnrichedFlow{
+		SrcAddr: net.ParseIP("10.1.2.3"),
+		SrcNet:  24,
+		SrcAs:   553,
+		DstAddr: net.ParseIP("203.0.113.1"),
+		DstNet:  24,
+		DstAs:   6830,
+	}
+	tests := map[string]bool{
+		`src rpki invalid`:                 true,
+		`dst rpki notfound`:                true,
+		`rpki invalid`:                     true, // incoming flow, remote is src
+		`rpki notfound`:                    false,
+		`either rpki notfound`:             true,
+		`both rpki invalid`:                false,
+		`local rpki notfound`:              true,
+		`has src rpki and has rpki`:        true,
+		`src rpki valid or dst rpki valid`: false,
+	}
+
+	for test, expected := range tests {
+		expr, err := parser.Parse(test)
+		if err != nil {
+			t.Errorf("Filter `%s` failed to parse with error:\n%s\n", test, err)
+			continue
+		}
+		filter := &Filter{RPKIValidator: validator}
+		result, err := filter.CheckFlow(expr, flowmsg)
+		if err != nil {
+			t.Error(err)
+		}
+		if result != expected {
+			t.Errorf("Filter `%s` returned %t for the test flow.\n", test, result)
+		}
+	}
+
+	// the status set by enrichment takes precedence for undirected matches
+	expr, _ := parser.Parse(`rpki valid and src rpki invalid`)
+	flowmsg.ValidationStatus = pb.EnrichedFlow_Valid
+	if result, _ := (&Filter{RPKIValidator: validator}).CheckFlow(expr, flowmsg); !result {
+		t.Errorf("Filter `rpki valid and src rpki invalid` ignored the enriched status.\n")
+	}
+
+	// directional matches can not be evaluated without validator
+	for _, test := range []string{`src rpki notfound`, `not dst rpki valid`, `remote rpki invalid`, `has src rpki`} {
+		expr, _ := parser.Parse(test)
+		if _, err := (&Filter{}).CheckFlow(expr, flowmsg); err == nil {
+			t.Errorf("Filter `%s` produced no error without validator.\n", test)
+		}
+	}
+	expr, _ = parser.Parse(`rpki valid`)
+	if _, err := (&Filter{}).CheckFlow(expr, flowmsg); err != nil {
+		t.Errorf("Filter `rpki valid` failed without validator:\n%s\n", err)
+	}
+
+	// flows without netsize can not be validated
+	expr, _ = parser.Parse(`not dst rpki valid`)
+	unknown := &pb.EnrichedFlow{DstAddr: net.ParseIP("10.0.0.1"), DstAs: 553}
+	filter := &Filter{RPKIValidator: validator, ThreeValued: true}
+	if result, _ := filter.CheckFlow(expr, unknown); result {
+		t.Errorf("Filter `not dst rpki valid` matched a flow without netsize.\n")
+	}
+}